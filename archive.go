@@ -0,0 +1,302 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// archive is the regular files in a tar or zip file, which is read once
+// (however many of its members are used) and cached in loadOptions.
+type archive struct {
+	members map[string][]byte
+	// names of the members, sorted
+	names []string
+}
+
+// archiveKinds are the supported archive types by extension.
+var archiveKinds = []struct {
+	extension string
+	read      func(data []byte) (map[string][]byte, error)
+}{
+	{".tar.gz", readTarGz},
+	{".tgz", readTarGz},
+	{".tar", readTar},
+	{".zip", readZip},
+}
+
+// splitArchive splits archive!member, unescaping any \! in either part.
+func splitArchive(data string) (string /* archive */, string /* member */, bool) {
+	var archive strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch {
+		case strings.HasPrefix(data[i:], `\!`):
+			archive.WriteByte('!')
+			i++
+		case data[i] == '!':
+			return archive.String(), strings.Replace(data[i+1:], `\!`, "!", -1), true
+		default:
+			archive.WriteByte(data[i])
+		}
+	}
+	return archive.String(), "", false
+}
+
+// openArchive reads the archive filename, or returns it from the cache if
+// it's already been read. read is used to read the file itself (so that
+// context archives are confined to -root).
+func (opts *loadOptions) openArchive(filename string, read func(string) ([]byte, error)) (*archive, error) {
+	if a, ok := opts.archives[filename]; ok {
+		return a, nil
+	}
+
+	for _, kind := range archiveKinds {
+		if !strings.HasSuffix(filename, kind.extension) {
+			continue
+		}
+		data, err := read(filename)
+		if err != nil {
+			return nil, err
+		}
+		members, err := kind.read(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+
+		a := &archive{members: members, names: make([]string, 0, len(members))}
+		for name := range members {
+			a.names = append(a.names, name)
+		}
+		sort.Strings(a.names)
+		if opts.archives == nil {
+			opts.archives = make(map[string]*archive)
+		}
+		opts.archives[filename] = a
+		return a, nil
+	}
+
+	return nil, fmt.Errorf("%s isn't a .tar, .tar.gz, .tgz or .zip archive (use \\! for a ! in a filename)", filename)
+}
+
+// member returns the contents of the named member.
+func (a *archive) member(name string) ([]byte, error) {
+	if data, ok := a.members[name]; ok {
+		return data, nil
+	}
+	if similar := a.similarNames(name); len(similar) > 0 {
+		return nil, fmt.Errorf("no member %s (did you mean %s?)", name, strings.Join(similar, ", "))
+	}
+	return nil, fmt.Errorf("no member %s", name)
+}
+
+// glob returns the names of the members matching pattern (see path.Match).
+func (a *archive) glob(pattern string) ([]string, error) {
+	var matches []string
+	for _, name := range a.names {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			matches = append(matches, name)
+		}
+	}
+	return matches, nil
+}
+
+// maxSimilarNames is the most near misses listed when a member is missing.
+const maxSimilarNames = 3
+
+// similarNames returns the members whose names are close to name: those
+// with the same basename, or within a few edits of it.
+func (a *archive) similarNames(name string) []string {
+	var similar []string
+	for _, candidate := range a.names {
+		if path.Base(candidate) == path.Base(name) || editDistance(candidate, name) <= len(name)/4+1 {
+			similar = append(similar, candidate)
+			if len(similar) == maxSimilarNames {
+				break
+			}
+		}
+	}
+	return similar
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func readTarGz(data []byte) (map[string][]byte, error) {
+	uncompressed, err := gunzip(data)
+	if err != nil {
+		return nil, err
+	}
+	return readTar(uncompressed)
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return ioutil.ReadAll(gz)
+}
+
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func readTar(data []byte) (map[string][]byte, error) {
+	members := make(map[string][]byte)
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		members[path.Clean(header.Name)] = content
+	}
+}
+
+func readZip(data []byte) (map[string][]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string][]byte)
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+		members[path.Clean(f.Name)] = content
+	}
+	return members, nil
+}
+
+// isGlob reports whether a member name is a pattern.
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// archiveContent is context data from a member of an archive.
+type archiveContent struct {
+	format  inputFormat
+	archive string
+	member  string
+	opts    *loadOptions
+}
+
+func (ac *archiveContent) name() string {
+	return ac.archive + "!" + ac.member
+}
+
+func (ac *archiveContent) load() (interface{}, error) {
+	if isGlob(ac.member) {
+		return nil, fmt.Errorf("%s: archive patterns can only be used in a list (e.g. key:... %s)", ac.name(), ac.name())
+	}
+	a, err := ac.opts.openArchive(ac.archive, ac.opts.readFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := a.member(ac.member)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", ac.archive, err)
+	}
+	result, err := loadBytes(ac.format, data, ac.opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", ac.name(), err)
+	}
+	return result, nil
+}
+
+func (ac *archiveContent) metadata() map[string]interface{} {
+	basename := path.Base(ac.member)
+	return map[string]interface{}{
+		"archive":  ac.archive,
+		"filename": ac.member,
+		"basename": basename,
+		"name":     strings.TrimSuffix(basename, filepath.Ext(basename)),
+	}
+}
+
+// expand returns the contents for each member matching the pattern, like
+// a shell glob would for files. It's an error if nothing matches.
+func (ac *archiveContent) expand() ([]*archiveContent, error) {
+	a, err := ac.opts.openArchive(ac.archive, ac.opts.readFile)
+	if err != nil {
+		return nil, err
+	}
+	names, err := a.glob(ac.member)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", ac.name(), err)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s: no members match %s", ac.archive, ac.member)
+	}
+
+	expanded := make([]*archiveContent, len(names))
+	for i, name := range names {
+		expanded[i] = &archiveContent{format: ac.format, archive: ac.archive, member: name, opts: ac.opts}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,48 @@
+//go:build aws
+// +build aws
+
+package main
+
+import (
+	// aliased since context is already a type in this package
+	gocontext "context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	awsConfigOnce sync.Once
+	awsConfig     aws.Config
+	awsConfigErr  error
+)
+
+// loadAWSConfig loads the default AWS configuration the first time an
+// AWS source is used, checking that there are credentials so that their
+// absence isn't reported as some other failure.
+func loadAWSConfig(ctx gocontext.Context) (aws.Config, error) {
+	awsConfigOnce.Do(func() {
+		awsConfig, awsConfigErr = config.LoadDefaultConfig(ctx)
+		if awsConfigErr != nil {
+			return
+		}
+		if _, err := awsConfig.Credentials.Retrieve(ctx); err != nil {
+			awsConfigErr = fmt.Errorf("no usable AWS credentials (set AWS_PROFILE, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or run on an instance with a role): %s", err)
+		}
+	})
+	return awsConfig, awsConfigErr
+}
+
+// describeAWSError adds a hint to permission errors, which otherwise
+// look much like any other failure.
+func describeAWSError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied" {
+		return fmt.Errorf("access denied (check the permissions of the AWS credentials in use): %s", apiErr.ErrorMessage())
+	}
+	return err
+}
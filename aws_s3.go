@@ -0,0 +1,62 @@
+//go:build aws
+// +build aws
+
+package main
+
+import (
+	// aliased since context is already a type in this package
+	gocontext "context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func init() {
+	uriSources["s3"] = uriSource{
+		description: "Amazon S3 object (s3://bucket/key; metadata has bucket, key and etag)",
+		fetch:       fetchS3Object,
+	}
+}
+
+func fetchS3Object(resource string) ([]byte, map[string]interface{}, error) {
+	bucket, key, err := splitBucketKey(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := gocontext.Background()
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	output, err := s3.NewFromConfig(cfg).GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	var noSuchKey *types.NoSuchKey
+	var noSuchBucket *types.NoSuchBucket
+	switch {
+	case errors.As(err, &noSuchKey):
+		return nil, nil, fmt.Errorf("no object %q in bucket %q", key, bucket)
+	case errors.As(err, &noSuchBucket):
+		return nil, nil, fmt.Errorf("no bucket %q", bucket)
+	case err != nil:
+		return nil, nil, describeAWSError(err)
+	}
+	defer output.Body.Close()
+
+	data, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, map[string]interface{}{
+		"bucket": bucket,
+		"key":    key,
+		"etag":   strings.Trim(aws.ToString(output.ETag), `"`),
+	}, nil
+}
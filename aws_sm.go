@@ -0,0 +1,37 @@
+//go:build aws
+// +build aws
+
+package main
+
+import (
+	// aliased since context is already a type in this package
+	gocontext "context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+func init() {
+	uriSources["aws-sm"] = uriSource{
+		description: "AWS Secrets Manager secret (aws-sm://name-or-arn)",
+		fetch:       fetchAWSSecret,
+	}
+}
+
+func fetchAWSSecret(secretID string) ([]byte, map[string]interface{}, error) {
+	ctx := gocontext.Background()
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	output, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		return nil, nil, describeAWSError(err)
+	}
+	if output.SecretString != nil {
+		return []byte(*output.SecretString), nil, nil
+	}
+	return output.SecretBinary, nil, nil
+}
@@ -0,0 +1,129 @@
+//go:build aws
+// +build aws
+
+package main
+
+import (
+	// aliased since context is already a type in this package
+	gocontext "context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func init() {
+	storeSources["ssm"] = storeSource{
+		description: "AWS SSM Parameter Store parameter, or every parameter under a path ending in / (nested by /)",
+		load:        loadSSMParameters,
+	}
+}
+
+// ssmMaxAttempts is how many times a (throttled) request is tried, since
+// reading a large tree of parameters easily hits the rate limit.
+const ssmMaxAttempts = 10
+
+// unlimitedRetries is a retry.RateLimiter that never runs out of retries
+// (as ratelimit.None does in later SDK versions).
+type unlimitedRetries struct{}
+
+func (unlimitedRetries) GetToken(gocontext.Context, uint) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+func (unlimitedRetries) AddTokens(uint) error {
+	return nil
+}
+
+func loadSSMParameters(path string) (interface{}, error) {
+	ctx := gocontext.Background()
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := ssm.NewFromConfig(cfg, func(o *ssm.Options) {
+		o.Retryer = retry.NewStandard(func(so *retry.StandardOptions) {
+			so.MaxAttempts = ssmMaxAttempts
+			// the backoff is enough; the client side retry quota would
+			// otherwise give up on a long run of throttling
+			so.RateLimiter = unlimitedRetries{}
+		})
+	})
+
+	if !strings.HasSuffix(path, "/") {
+		output, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(path),
+			WithDecryption: aws.Bool(true),
+		})
+		var notFound *types.ParameterNotFound
+		if errors.As(err, &notFound) {
+			return nil, errors.New("no such parameter (use a trailing / to read every parameter under a path)")
+		} else if err != nil {
+			return nil, describeAWSError(err)
+		}
+		return ssmValue(*output.Parameter), nil
+	}
+
+	result := make(map[string]interface{})
+	paginator := ssm.NewGetParametersByPathPaginator(client, &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, describeAWSError(err)
+		}
+		for _, parameter := range page.Parameters {
+			name := strings.TrimPrefix(aws.ToString(parameter.Name), path)
+			if err := setSSMParameter(result, strings.Split(name, "/"), ssmValue(parameter)); err != nil {
+				return nil, fmt.Errorf("%s: %s", aws.ToString(parameter.Name), err)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no parameters under this path")
+	}
+	return result, nil
+}
+
+// ssmValue is the value of a parameter, with StringLists split.
+func ssmValue(parameter types.Parameter) interface{} {
+	value := aws.ToString(parameter.Value)
+	if parameter.Type != types.ParameterTypeStringList {
+		return value
+	}
+	var list []interface{}
+	for _, item := range strings.Split(value, ",") {
+		list = append(list, item)
+	}
+	return list
+}
+
+// setSSMParameter sets the value at path, creating maps as needed.
+func setSSMParameter(m map[string]interface{}, path []string, value interface{}) error {
+	for i, part := range path[:len(path)-1] {
+		child, ok := m[part]
+		if !ok {
+			child = make(map[string]interface{})
+			m[part] = child
+		}
+		childMap, ok := child.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("conflicts with the parameter %s", strings.Join(path[:i+1], "/"))
+		}
+		m = childMap
+	}
+
+	last := path[len(path)-1]
+	if _, ok := m[last]; ok {
+		return errors.New("conflicts with parameters under it")
+	}
+	m[last] = value
+	return nil
+}
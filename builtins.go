@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/wryun/rjsone/ext"
+)
+
+// builtins are the functions without side effects that rjsone adds to
+// every context, as json-e has its own (unless -no-builtins is given).
+// Each file of them adds its functions here in init. Unlike other
+// registered functions, a context key with the same name replaces a
+// builtin without a warning, since adding a builtin shouldn't make
+// existing contexts noisy.
+var builtins = make(map[string]interface{})
+
+// fsBuiltins are the builtins that read files, made for each run so that
+// they honour -root and -relative-to-template. -no-fs-builtins leaves
+// them out.
+var fsBuiltins = make(map[string]func(opts *loadOptions) interface{})
+
+// isBuiltinName reports whether name is one of the builtins.
+func isBuiltinName(name string) bool {
+	_, ok := builtins[name]
+	_, fsOK := fsBuiltins[name]
+	return ok || fsOK
+}
+
+// isBuiltin reports whether the context value v (under key) is the
+// builtin of that name, rather than a context key (other than a function)
+// that replaced it.
+func isBuiltin(key string, v interface{}) bool {
+	fn, registered := ext.Function(key)
+	return isBuiltinName(key) && registered && reflect.TypeOf(v) == reflect.TypeOf(fn)
+}
+
+// registerBuiltins registers every builtin (see
+// ext.RegisterFunction).
+func registerBuiltins() error {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := ext.RegisterFunction(name, builtins[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerFSBuiltins registers the fsBuiltins for opts. As they're
+// registered after plugins are loaded, a plugin's function of the same
+// name is kept.
+func registerFSBuiltins(opts *loadOptions) error {
+	names := make([]string, 0, len(fsBuiltins))
+	for name := range fsBuiltins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := ext.Function(name); ok {
+			continue
+		}
+		if err := ext.RegisterFunction(name, fsBuiltins[name](opts)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+func init() {
+	builtins["toSnakeCase"] = toSnakeCase
+	builtins["toKebabCase"] = toKebabCase
+	builtins["toCamelCase"] = toCamelCase
+	builtins["title"] = titleBuiltin
+	builtins["trimPrefix"] = strings.TrimPrefix
+	builtins["trimSuffix"] = strings.TrimSuffix
+}
+
+// toKebabCase is toSnakeCase (see keys.go) with hyphens.
+func toKebabCase(s string) string {
+	words := splitWords(s)
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+	return strings.Join(words, "-")
+}
+
+// titleBuiltin capitalises the first letter of each word, where words are
+// separated by whitespace (unlike strings.Title, so "don't" isn't
+// "Don'T"), leaving the rest of the string as it is.
+func titleBuiltin(s string) string {
+	runes := []rune(s)
+	for i, r := range runes {
+		if i == 0 || unicode.IsSpace(runes[i-1]) {
+			runes[i] = unicode.ToTitle(r)
+		}
+	}
+	return string(runes)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+)
+
+func init() {
+	builtins["cidrHost"] = cidrHostBuiltin
+	builtins["cidrSubnet"] = cidrSubnetBuiltin
+	builtins["cidrContains"] = cidrContainsBuiltin
+	builtins["ipAdd"] = ipAddBuiltin
+}
+
+// ipToInt returns ip as a number, and how many bits it has (32 for IPv4,
+// 128 for IPv6), so the builtins can do arithmetic on either.
+func ipToInt(ip net.IP) (*big.Int, int) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return new(big.Int).SetBytes(ip4), 32
+	}
+	return new(big.Int).SetBytes(ip.To16()), 128
+}
+
+// intToIP is the reverse of ipToInt, failing if n doesn't fit in bits.
+func intToIP(n *big.Int, bits int) (net.IP, error) {
+	if n.Sign() < 0 || n.BitLen() > bits {
+		if bits == 32 {
+			return nil, errors.New("result is outside the IPv4 address space")
+		}
+		return nil, errors.New("result is outside the IPv6 address space")
+	}
+	ip := make(net.IP, bits/8)
+	b := n.Bytes()
+	copy(ip[len(ip)-len(b):], b)
+	return ip, nil
+}
+
+// formatIP formats a bits bit address, keeping IPv4-mapped IPv6
+// addresses in IPv6 form (which net.IP's String doesn't).
+func formatIP(ip net.IP, bits int) string {
+	if ip4 := ip.To4(); bits == 128 && ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
+
+// toInteger converts a json-e number to an int64, refusing fractions
+// rather than silently truncating them.
+func toInteger(name string, f float64) (int64, error) {
+	if f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+		return 0, fmt.Errorf("%s should be an integer, not %v", name, f)
+	}
+	return int64(f), nil
+}
+
+// parseCIDR returns the first address of cidr as a number, along with
+// the length of its prefix and how many bits its addresses have. The
+// mask decides the latter, so an IPv4-mapped IPv6 CIDR (e.g.
+// ::ffff:10.0.0.0/104) has 128 bit addresses, as its prefix length
+// assumes.
+func parseCIDR(cidr string) (*big.Int, int, int, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	ones, bits := network.Mask.Size()
+	ip := network.IP.To16()
+	if bits == 32 {
+		ip = network.IP.To4()
+	}
+	if ip == nil || len(ip)*8 != bits {
+		return nil, 0, 0, fmt.Errorf("invalid CIDR address: %s", cidr)
+	}
+	return new(big.Int).SetBytes(ip), ones, bits, nil
+}
+
+// cidrHostBuiltin returns the nth address in cidr, where a negative n
+// counts back from the end (so -1 is the last).
+func cidrHostBuiltin(cidr string, n float64) (string, error) {
+	base, ones, bits, err := parseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("cidrHost: %s", err)
+	}
+	hostNum, err := toInteger("host number", n)
+	if err != nil {
+		return "", fmt.Errorf("cidrHost: %s", err)
+	}
+
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	offset := big.NewInt(hostNum)
+	if hostNum < 0 {
+		offset.Add(offset, size)
+	}
+	if offset.Sign() < 0 || offset.Cmp(size) >= 0 {
+		return "", fmt.Errorf("cidrHost: %s has %s addresses, so there's no host %d", cidr, size, hostNum)
+	}
+	ip, err := intToIP(base.Add(base, offset), bits)
+	if err != nil {
+		return "", fmt.Errorf("cidrHost: %s", err)
+	}
+	return formatIP(ip, bits), nil
+}
+
+// cidrSubnetBuiltin returns the index'th subnet of cidr that has newBits
+// more bits in its prefix (e.g. cidrSubnet("10.0.0.0/16", 8, 2) is
+// 10.0.2.0/24).
+func cidrSubnetBuiltin(cidr string, newBits float64, index float64) (string, error) {
+	base, ones, bits, err := parseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("cidrSubnet: %s", err)
+	}
+	extra, err := toInteger("newbits", newBits)
+	if err != nil {
+		return "", fmt.Errorf("cidrSubnet: %s", err)
+	}
+	subnet, err := toInteger("index", index)
+	if err != nil {
+		return "", fmt.Errorf("cidrSubnet: %s", err)
+	}
+
+	prefix := int64(ones) + extra
+	if extra < 0 || prefix > int64(bits) {
+		return "", fmt.Errorf("cidrSubnet: can't add %d bits to the /%d prefix of %s (there are %d bits)", extra, ones, cidr, bits)
+	}
+	count := new(big.Int).Lsh(big.NewInt(1), uint(extra))
+	if subnet < 0 || big.NewInt(subnet).Cmp(count) >= 0 {
+		return "", fmt.Errorf("cidrSubnet: %s has %s subnets of /%d, so there's no subnet %d", cidr, count, prefix, subnet)
+	}
+	offset := new(big.Int).Lsh(big.NewInt(subnet), uint(int64(bits)-prefix))
+	ip, err := intToIP(base.Add(base, offset), bits)
+	if err != nil {
+		return "", fmt.Errorf("cidrSubnet: %s", err)
+	}
+	return fmt.Sprintf("%s/%d", formatIP(ip, bits), prefix), nil
+}
+
+func cidrContainsBuiltin(cidr string, address string) (bool, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, fmt.Errorf("cidrContains: %s", err)
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false, fmt.Errorf("cidrContains: invalid IP address %q", address)
+	}
+	return network.Contains(ip), nil
+}
+
+// ipAddBuiltin returns the address n after (or, if n is negative, before)
+// address, failing rather than wrapping at the ends of the address space.
+func ipAddBuiltin(address string, n float64) (string, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("ipAdd: invalid IP address %q", address)
+	}
+	delta, err := toInteger("n", n)
+	if err != nil {
+		return "", fmt.Errorf("ipAdd: %s", err)
+	}
+	value, bits := ipToInt(ip)
+	result, err := intToIP(value.Add(value, big.NewInt(delta)), bits)
+	if err != nil {
+		return "", fmt.Errorf("ipAdd: %s + %d: %s", address, delta, err)
+	}
+	return result.String(), nil
+}
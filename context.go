@@ -1,30 +1,171 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/imdario/mergo"
 
 	jsone_interpreter "github.com/taskcluster/json-e/interpreter"
-	// Quick hack of ghodss YAML to expose a new method
-	yaml_ghodss "github.com/wryun/yaml-1"
 )
 
-func parseContexts(rawContexts []string) []context {
+// stdinArgs is the argument that is replaced by arguments read from stdin.
+const stdinArgs = "@-"
+
+// maxArgsFileDepth is how deeply @file arguments can be nested.
+const maxArgsFileDepth = 2
+
+// expandArgs replaces @file (or stdinArgs) with the arguments read from
+// the file (or stdin), and reports whether stdin was read.
+func expandArgs(rawContexts []string, stdin io.Reader) ([]string, bool, error) {
+	e := argsExpander{stdin: stdin}
+	expanded, err := e.expand(rawContexts, 0)
+	return expanded, e.readStdin, err
+}
+
+type argsExpander struct {
+	stdin     io.Reader
+	readStdin bool
+}
+
+func (e *argsExpander) expand(rawContexts []string, depth int) ([]string, error) {
+	expanded := make([]string, 0, len(rawContexts))
+
+	for _, rawContext := range rawContexts {
+		if !strings.HasPrefix(rawContext, "@") {
+			expanded = append(expanded, rawContext)
+			continue
+		}
+
+		if depth >= maxArgsFileDepth {
+			return nil, fmt.Errorf("%s: argument files can only be nested %d deep", rawContext, maxArgsFileDepth-1)
+		}
+
+		var r io.Reader
+		if rawContext == stdinArgs {
+			if e.readStdin {
+				return nil, fmt.Errorf("%s can only be used once", stdinArgs)
+			}
+			e.readStdin = true
+			r = e.stdin
+		} else {
+			f, err := os.Open(rawContext[1:])
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		args, err := readArgs(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", rawContext, err)
+		}
+		args, err = e.expand(args, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, args...)
+	}
+
+	return expanded, nil
+}
+
+// readArgs reads one argument per line, ignoring blank lines and
+// comments. A line in double quotes is unquoted as a Go string.
+func readArgs(r io.Reader) ([]string, error) {
+	var args []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, `"`) {
+			unquoted, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted argument %s", line)
+			}
+			line = unquoted
+		}
+		args = append(args, line)
+	}
+	return args, scanner.Err()
+}
+
+// readsStdin reports whether any of the contexts will read from stdin.
+func readsStdin(contexts []context) bool {
+	return readsDescriptor(contexts, func(fd int) bool { return fd == 0 })
+}
+
+func contentReadsStdin(c content) bool {
+	return contentReadsDescriptor(c, func(fd int) bool { return fd == 0 })
+}
+
+// readsDescriptor reports whether any of contexts reads from a file
+// descriptor that matches (with stdin being 0).
+func readsDescriptor(contexts []context, matches func(int) bool) bool {
+	for _, context := range contexts {
+		if contentReadsDescriptor(context.content, matches) {
+			return true
+		}
+	}
+	return false
+}
+
+func contentReadsDescriptor(c content, matches func(int) bool) bool {
+	switch typedC := c.(type) {
+	case *stdinContent:
+		return matches(0)
+	case *fdContent:
+		return matches(typedC.fd)
+	case *listContent:
+		return readsDescriptor(typedC.contexts, matches)
+	case *patchContent:
+		return contentReadsDescriptor(typedC.content, matches)
+	case *pointerContent:
+		return contentReadsDescriptor(typedC.content, matches)
+	case *contextJSONContent:
+		return contentReadsDescriptor(typedC.content, matches)
+	default:
+		return false
+	}
+}
+
+// listTerminator is the argument that ends a list context.
+const listTerminator = ":"
+
+func parseContexts(rawContexts []string, opts *loadOptions) ([]context, error) {
 	contexts := make([]context, 0)
 
 	var lc *listContent
+	// lists by key, so a list can be added to again later
+	lists := make(map[string]*listContent)
 
 	for _, rawContext := range rawContexts {
+		if rawContext == listTerminator {
+			if lc == nil {
+				return nil, fmt.Errorf("%q (end of list) used when no list is open", listTerminator)
+			}
+			lc = nil
+			continue
+		}
+
 		key := ""
 		var rawContent string
 		if strings.HasPrefix(rawContext, "+") {
@@ -32,6 +173,9 @@ func parseContexts(rawContexts []string) []context {
 			// try to find keys in it (otherwise we can't easily pass raw
 			// JSON/YAML as an argument)
 			rawContent = rawContext
+		} else if uriRegexp.MatchString(rawContext) || fdRegexp.MatchString(rawContext) {
+			// similarly, the scheme of a bare URI (or fd:N) isn't a key
+			rawContent = rawContext
 		} else {
 			splitContext := strings.SplitN(rawContext, ":", 2)
 			if len(splitContext) < 2 {
@@ -42,13 +186,58 @@ func parseContexts(rawContexts []string) []context {
 			}
 		}
 
+		key, transform, err := parseKeyOptions(key)
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %s", rawContext, err)
+		}
+		rawContent, transform = splitRenames(rawContent, transform)
+		rawContent, transforms, err := splitTransforms(rawContent, opts)
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %s", rawContext, err)
+		}
+		deepMerge := strings.HasSuffix(key, "+")
+		if deepMerge {
+			key = strings.TrimSuffix(key, "+")
+			if key == "" {
+				return nil, fmt.Errorf("context %s: + (deep merge) needs a key", rawContext)
+			}
+		}
+
 		if key != "" {
 			// If we have a new key, we should jump out of any list we're in
 			lc = nil
 		}
 
-		parsedContext := context{rawContext, key, parseContent(rawContent, lc)}
+		parsedContext := context{
+			original:   rawContext,
+			key:        key,
+			transform:  transform,
+			transforms: transforms,
+			deepMerge:  deepMerge,
+			content:    parseContent(rawContent, lc, opts),
+			opts:       opts,
+		}
+		if fc, ok := parsedContext.content.(*functionContent); ok {
+			fc.name = key
+		}
+		if path := splitKeyPath(key); len(path) > 1 {
+			// dotted keys are nested (e.g. db.host)
+			parsedContext.path = path
+		} else if len(path) == 1 {
+			parsedContext.key = path[0]
+		}
 		if newLc, ok := parsedContext.content.(*listContent); ok {
+			if deepMerge {
+				return nil, fmt.Errorf("context %s: lists can't be deep merged", rawContext)
+			}
+			if existingLc, ok := lists[key]; ok {
+				if existingLc.childFormat != newLc.childFormat || existingLc.showMetadata != newLc.showMetadata {
+					return nil, fmt.Errorf("context %s: list %q was already opened with a different format or metadata setting", rawContext, key)
+				}
+				lc = existingLc
+				continue
+			}
+			lists[key] = newLc
 			lc = newLc
 			contexts = append(contexts, parsedContext)
 		} else if lc != nil {
@@ -59,10 +248,40 @@ func parseContexts(rawContexts []string) []context {
 
 	}
 
-	return contexts
+	return contexts, nil
 }
 
-func parseContent(content string, lc *listContent) content {
+// contextJSONContent is the context given by -context-json, which must
+// be an object since, unlike a positional context, it can't have a key.
+type contextJSONContent struct {
+	content content
+}
+
+// newContextJSONContent reads value as JSON, or @ and the file to read it
+// from.
+func newContextJSONContent(value string, opts *loadOptions) *contextJSONContent {
+	if strings.HasPrefix(value, "@") {
+		return &contextJSONContent{content: newContent(jsonFormat, value[1:], opts)}
+	}
+	return &contextJSONContent{content: &textContent{format: jsonFormat, text: value, opts: opts}}
+}
+
+func (cc *contextJSONContent) load() (interface{}, error) {
+	result, err := cc.content.load()
+	if err != nil {
+		return nil, fmt.Errorf("-context-json: %s", err)
+	}
+	if _, ok := result.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("-context-json should be an object, not %s (%s)", describeType(result), preview(result))
+	}
+	return result, nil
+}
+
+func (cc *contextJSONContent) metadata() map[string]interface{} {
+	return cc.content.metadata()
+}
+
+func parseContent(content string, lc *listContent, opts *loadOptions) content {
 	fmtPointer, data := parseFormat(content)
 
 	var format inputFormat
@@ -77,28 +296,93 @@ func parseContent(content string, lc *listContent) content {
 		}
 	} else if *fmtPointer == "" {
 		format = textFormat
+	} else if string(*fmtPointer)+":" == fdPrefix {
+		// key:fd:3 is a descriptor in the default format, not format fd
+		format = yamlFormat
+		data = fdPrefix + data
 	} else {
 		format = *fmtPointer
 	}
 
+	if fmtPointer == nil && (lc == nil || !lc.explicitFormat) {
+		if opts.isTextFile(data) {
+			format = textFormat
+		} else if inferred, ok := formatFromExtension(data); ok && opts.autoFormat {
+			format = inferred
+		}
+	}
+
+	if format == jsonPatchFormat || format == mergePatchFormat {
+		// patches are written in YAML/JSON, but are applied to the
+		// accumulated context by loadContext rather than merged into it.
+		return &patchContent{format: format, content: newContent(yamlFormat, data, opts)}
+	}
+
 	// TODO: this currently allows a bunch of stupid things
 	// (e.g. embedded listContents...). Should write a proper grammar.
+	switch data {
+	case "..":
+		return &listContent{childFormat: format, showMetadata: false, explicitFormat: fmtPointer != nil}
+	case "...":
+		return &listContent{childFormat: format, showMetadata: true, explicitFormat: fmtPointer != nil}
+	default:
+		return newContent(format, data, opts)
+	}
+}
+
+func newContent(format inputFormat, data string, opts *loadOptions) content {
+	if isStoreFormat(format) {
+		return &storeContent{format: format, path: data}
+	}
+
 	switch {
-	case data == "..":
-		return &listContent{childFormat: format, showMetadata: false}
-	case data == "...":
-		return &listContent{childFormat: format, showMetadata: true}
 	case strings.HasPrefix(data, "+"):
-		return &textContent{format: format, text: data[1:]}
-	case data == "-":
-		return &stdinContent{format: format}
+		return &textContent{format: format, text: data[1:], opts: opts}
+	case strings.HasPrefix(data, "---"):
+		return newFunctionContent(format, data[3:], true, true, opts)
 	case strings.HasPrefix(data, "--"):
-		return &functionContent{rawInput: format == textFormat, rawOutput: true, function: data[2:]}
-	case strings.HasPrefix(data, "-"):
-		return &functionContent{rawInput: format == textFormat, rawOutput: false, function: data[1:]}
-	default:
-		return &fileContent{format: format, filename: data}
+		return newFunctionContent(format, data[2:], true, false, opts)
+	case strings.HasPrefix(data, "-") && data != "-" && !strings.HasPrefix(data, "-#"):
+		return newFunctionContent(format, data[1:], false, false, opts)
+	}
+
+	// files and stdin can select part of the document with a JSON pointer
+	source, pointer, hasPointer := splitPointer(data)
+
+	var c content
+	if match := uriRegexp.FindStringSubmatch(source); match != nil {
+		c = &uriContent{format: format, scheme: match[1], resource: match[2], opts: opts}
+	} else if source == "-" {
+		c = &stdinContent{format: format, opts: opts}
+	} else if strings.HasPrefix(source, fdPrefix) {
+		c = newFDContent(format, source[len(fdPrefix):], opts)
+	} else if archive, member, ok := splitArchive(source); ok {
+		c = &archiveContent{format: format, archive: archive, member: member, opts: opts}
+	} else {
+		c = &fileContent{format: format, filename: archive, opts: opts}
+	}
+
+	if hasPointer {
+		return &pointerContent{pointer: pointer, content: c}
+	}
+	return c
+}
+
+// splitPointer splits source#pointer, unescaping any \# in source.
+func splitPointer(data string) (string /* source */, string /* pointer */, bool) {
+	var source strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch {
+		case strings.HasPrefix(data[i:], `\#`):
+			source.WriteByte('#')
+			i++
+		case data[i] == '#':
+			return source.String(), data[i+1:], true
+		default:
+			source.WriteByte(data[i])
+		}
 	}
+	return source.String(), "", false
 }
 
 type inputFormat string
@@ -108,6 +392,13 @@ const (
 	jsonFormat = inputFormat("json")
 	kvFormat   = inputFormat("kv")
 	textFormat = inputFormat("text")
+
+	prototextFormat   = inputFormat("prototext")
+	frontmatterFormat = inputFormat("frontmatter")
+	ndjsonFormat      = inputFormat("ndjson")
+
+	jsonPatchFormat  = inputFormat("jsonpatch")
+	mergePatchFormat = inputFormat("mergepatch")
 )
 
 // parseFormat part of content (content = :format:data)
@@ -120,6 +411,12 @@ func parseFormat(content string) (*inputFormat /* format */, string /* data */)
 
 	content = content[1:]
 
+	// a URI straight after the key (key:https://...) has no format, so
+	// its scheme isn't one
+	if uriRegexp.MatchString(content) {
+		return nil, content
+	}
+
 	// Hack: if the first thing after the ':' is a '+', it must be
 	// raw yaml/json (and we don't want to split on ':', as that might
 	// be a valid char...)
@@ -140,18 +437,33 @@ func parseFormat(content string) (*inputFormat /* format */, string /* data */)
 }
 
 type context struct {
-	original string
-	key      string
+	original  string
+	key       string
+	transform *keyTransform
+	// transforms are the json-e templates (from |template suffixes) the
+	// value is passed through, in order, before transform
+	transforms []string
+	// path is set if the value belongs at a nested path rather than
+	// directly under key
+	path []string
+	// deepMerge (key+:...) merges the value into any existing value
+	// under the key rather than replacing it
+	deepMerge bool
 
 	content content
+	opts    *loadOptions
 }
 
 func (c *context) eval() (interface{}, error) {
-	result, err := c.content.load()
+	result, err := c.evalValue()
 	if err != nil {
 		return nil, err
 	}
 
+	if len(c.path) > 0 {
+		return wrapPath(c.path, result), nil
+	}
+
 	if c.key != "" {
 		return map[string]interface{}{c.key: result}, nil
 	}
@@ -159,54 +471,315 @@ func (c *context) eval() (interface{}, error) {
 	return result, nil
 }
 
-func loadBytes(format inputFormat, data []byte) (interface{}, error) {
-	switch format {
-	case jsonFormat:
-		var result interface{}
-		if err := json.Unmarshal(data, &result); err != nil {
-			return nil, err
+// evalValue loads the context's value, without putting it under its key.
+func (c *context) evalValue() (interface{}, error) {
+	result, err := c.content.load()
+	if _, ok := err.(*encodingError); ok {
+		return nil, fmt.Errorf("context %s: %s", c.original, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, filename := range c.transforms {
+		result, err = applyTransform(filename, result, c.opts)
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %s", c.original, err)
+		}
+	}
+
+	if c.transform != nil {
+		result, err = c.transform.apply(result)
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %s", c.original, err)
+		}
+	}
+
+	return result, nil
+}
+
+// splitKeyPath splits a context key on dots, except where they are
+// escaped as \. (e.g. a\.b.c is ["a.b", "c"]).
+func splitKeyPath(key string) []string {
+	if key == "" {
+		return nil
+	}
+	var path []string
+	var current strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key) && key[i+1] == '.':
+			current.WriteByte('.')
+			i++
+		case key[i] == '.':
+			path = append(path, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(key[i])
 		}
-		return result, nil
-	case yamlFormat:
-		var result interface{}
-		if err := yaml_ghodss.Unmarshal(data, &result); err != nil {
+	}
+	return append(path, current.String())
+}
+
+// wrapPath returns value nested in objects with the keys in path.
+func wrapPath(path []string, value interface{}) interface{} {
+	for i := len(path) - 1; i >= 0; i-- {
+		value = map[string]interface{}{path[i]: value}
+	}
+	return value
+}
+
+// getPath returns the value at path in m, or nil if there isn't one.
+func getPath(m map[string]interface{}, path []string) interface{} {
+	var value interface{} = m
+	for _, k := range path {
+		valueMap, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = valueMap[k]
+	}
+	return value
+}
+
+// setPath sets the value at path in m, creating objects as required.
+func setPath(m map[string]interface{}, path []string, value interface{}) error {
+	for i, k := range path[:len(path)-1] {
+		child, ok := m[k]
+		if !ok {
+			child = make(map[string]interface{})
+			m[k] = child
+		}
+		childMap, ok := child.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot set %s: %s is %s", strings.Join(path, "."), strings.Join(path[:i+1], "."), describeType(child))
+		}
+		m = childMap
+	}
+	m[path[len(path)-1]] = value
+	return nil
+}
+
+// loadOptions are the command line options that affect how contexts are
+// loaded.
+type loadOptions struct {
+	expandEnv       bool
+	expandEnvStrict bool
+	// baseDir, if set, is the directory relative filenames are resolved against
+	baseDir string
+	// root, if set, is the directory all files must be inside
+	root string
+	// strictFunctionArgs rejects non-string function arguments rather
+	// than JSON encoding them
+	strictFunctionArgs bool
+	// strictFunctions parses function output as the function's declared
+	// format (rather than leniently as YAML), failing if it isn't valid
+	strictFunctions bool
+	// execShell runs inline function commands with the platform's shell
+	// rather than splitting them on spaces
+	execShell bool
+	// autoFormat infers the format of files without one from their
+	// extension (-auto-format)
+	autoFormat bool
+	// textExtensions are the extensions of files read as text when they
+	// don't have a format (-text-extensions)
+	textExtensions map[string]bool
+	// functionEnvAllowlist, if not nil, is the only environment variables
+	// function commands inherit (-function-env-allowlist)
+	functionEnvAllowlist []string
+	// execSlots, if not nil, limits how many function commands can run
+	// at once (-exec-parallelism)
+	execSlots chan struct{}
+
+	// coprocesses started so far, which are stopped at the end of the run
+	coprocesses []*coprocess
+	// kvAllowlist, if not nil, is the only keys kv contexts can have
+	// (-kv-allowlist)
+	kvAllowlist map[string]bool
+	// archives read so far, by filename
+	archives map[string]*archive
+	// fsys, if not nil, is the filesystem files, templates and includes
+	// are read from instead of the OS's (see ext.SetFS). Function
+	// commands still run from the OS filesystem.
+	fsys fs.FS
+}
+
+// resolve a filename given on the command line.
+func (opts *loadOptions) resolve(filename string) string {
+	if opts.baseDir == "" || filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(opts.baseDir, filename)
+}
+
+// readFile reads a file given on the command line, enforcing root.
+func (opts *loadOptions) readFile(filename string) ([]byte, error) {
+	resolved, err := opts.confine(opts.resolve(filename))
+	if err != nil {
+		return nil, err
+	}
+	return opts.readRaw(resolved)
+}
+
+// confine returns the real path of filename (i.e. with symlinks resolved)
+// if it is inside root. Files in fsys are always confined to it, so root
+// doesn't apply to them.
+func (opts *loadOptions) confine(filename string) (string, error) {
+	if opts.root == "" || opts.fsys != nil {
+		return filename, nil
+	}
+
+	resolved, inside, err := insideDir(opts.root, filename)
+	if err != nil {
+		return "", err
+	}
+	if !inside {
+		return "", fmt.Errorf("%s is outside the root directory %s", filename, opts.root)
+	}
+	return resolved, nil
+}
+
+// confineLexically is confine without resolving filename's symlinks, so
+// that a filename can be refused before anything (like whether it exists)
+// is revealed about it.
+func (opts *loadOptions) confineLexically(filename string) error {
+	if opts.root == "" || opts.fsys != nil {
+		return nil
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(opts.root)
+	if err != nil {
+		return err
+	}
+	if withinDir(root, abs) {
+		return nil
+	}
+	// filename may be under the root's real path
+	if realRoot, err := realPath(opts.root); err == nil && withinDir(realRoot, abs) {
+		return nil
+	}
+	return fmt.Errorf("%s is outside the root directory %s", filename, opts.root)
+}
+
+// insideDir returns the real path of filename, and whether it's inside
+// dir (once symlinks are resolved in both).
+func insideDir(dir string, filename string) (string, bool, error) {
+	realDir, err := realPath(dir)
+	if err != nil {
+		return "", false, err
+	}
+	resolved, err := realPath(filename)
+	if err != nil {
+		return "", false, err
+	}
+
+	return resolved, withinDir(realDir, resolved), nil
+}
+
+// withinDir returns whether the absolute path filename is dir or under
+// it, without resolving symlinks.
+func withinDir(dir string, filename string) bool {
+	rel, err := filepath.Rel(dir, filename)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func realPath(filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+func loadBytes(format inputFormat, data []byte, opts *loadOptions) (interface{}, error) {
+	data, err := checkEncoding(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.expandEnv && (format == yamlFormat || format == textFormat || isKVFormat(format)) {
+		var err error
+		data, err = expandEnv(data, opts.expandEnvStrict)
+		if err != nil {
 			return nil, err
 		}
-		return result, nil
-	case textFormat:
-		return string(data), nil
-	case kvFormat:
-		// TODO unicode?
-		lines := strings.Split(string(data), "\n")
-		result := make(map[string]interface{}, len(lines))
-		for _, line := range lines {
-			if line == "" {
-				continue
-			}
+	}
 
-			splitLine := strings.SplitN(line, " ", 2)
-			if len(splitLine) != 2 {
-				return nil, fmt.Errorf("line not in kv format: %q", line)
-			}
-			result[splitLine[0]] = splitLine[1]
+	var result interface{}
+	if loader, ok := inputFormats[format]; ok {
+		result, err = loader.load(data)
+	} else if isKVFormat(format) {
+		recordSep, fieldSep, sepErr := parseKVSeparators(format)
+		if sepErr != nil {
+			return nil, sepErr
 		}
-		return result, nil
-	default:
-		return nil, fmt.Errorf("format %q not supported", format)
+		result, err = parseKV(data, recordSep, fieldSep)
+	} else {
+		return nil, fmt.Errorf("format %q not supported (see -list-formats)", format)
+	}
+
+	if err == nil && isKVFormat(format) && opts.kvAllowlist != nil {
+		err = checkKVKeys(result.(map[string]interface{}), opts.kvAllowlist)
 	}
+	return result, err
+}
+
+// envRegexp matches the ${VAR}s that -expand-env replaces, along with
+// $${VAR}, which is the escaped form of a literal ${VAR}. A $ that isn't
+// followed by {, like $5, is left alone.
+var envRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// undefinedEnvError is returned by expandEnv in strict mode, so that the
+// file it's for can be added.
+type undefinedEnvError struct {
+	names []string
+}
+
+func (e *undefinedEnvError) Error() string {
+	return fmt.Sprintf("undefined environment variables: %s", strings.Join(e.names, ", "))
+}
+
+// expandEnv replaces ${VAR} in data with the environment variable VAR,
+// which if strict must be set (and is otherwise empty).
+func expandEnv(data []byte, strict bool) ([]byte, error) {
+	var missing []string
+	expanded := envRegexp.ReplaceAllFunc(data, func(match []byte) []byte {
+		if bytes.HasPrefix(match, []byte("$$")) {
+			return match[1:]
+		}
+		name := string(match[2 : len(match)-1])
+		value, ok := os.LookupEnv(name)
+		if !ok && strict {
+			missing = append(missing, name)
+		}
+		return []byte(value)
+	})
+
+	if len(missing) > 0 {
+		return nil, &undefinedEnvError{names: missing}
+	}
+	return expanded, nil
 }
 
 type fileContent struct {
 	format   inputFormat
 	filename string
+	opts     *loadOptions
 }
 
 func (fc *fileContent) load() (interface{}, error) {
-	resultBytes, err := ioutil.ReadFile(fc.filename)
+	resultBytes, err := fc.opts.readFile(fc.filename)
 	if err != nil {
 		return nil, err
 	}
-	return loadBytes(fc.format, resultBytes)
+	result, err := loadBytes(fc.format, resultBytes, fc.opts)
+	if envErr, ok := err.(*undefinedEnvError); ok {
+		return nil, fmt.Errorf("%s: %s", fc.filename, envErr)
+	}
+	return result, err
 }
 
 func (fc *fileContent) metadata() map[string]interface{} {
@@ -220,6 +793,7 @@ func (fc *fileContent) metadata() map[string]interface{} {
 
 type stdinContent struct {
 	format inputFormat
+	opts   *loadOptions
 }
 
 func (sc *stdinContent) load() (interface{}, error) {
@@ -227,26 +801,113 @@ func (sc *stdinContent) load() (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
-	return loadBytes(sc.format, resultBytes)
+	return loadBytes(sc.format, resultBytes, sc.opts)
 }
 
 func (sc *stdinContent) metadata() map[string]interface{} {
 	return map[string]interface{}{}
 }
 
+// fdPrefix starts a context read from an open file descriptor (e.g.
+// fd:3, given to rjsone as 3<file), which lets a pipeline pass several
+// inputs without temporary files.
+const fdPrefix = "fd:"
+
+var fdRegexp = regexp.MustCompile(`^fd:[0-9]+(#|$)`)
+
+type fdContent struct {
+	format     inputFormat
+	descriptor string
+	// fd is -1 if the descriptor isn't a valid number
+	fd   int
+	opts *loadOptions
+}
+
+func newFDContent(format inputFormat, descriptor string, opts *loadOptions) *fdContent {
+	fd, err := strconv.Atoi(descriptor)
+	if err != nil || fd < 0 {
+		fd = -1
+	}
+	return &fdContent{format: format, descriptor: descriptor, fd: fd, opts: opts}
+}
+
+func (fc *fdContent) load() (interface{}, error) {
+	if fc.fd == -1 {
+		return nil, fmt.Errorf("%s%s: file descriptor should be a number", fdPrefix, fc.descriptor)
+	}
+
+	f := os.NewFile(uintptr(fc.fd), fdPrefix+fc.descriptor)
+	resultBytes, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return loadBytes(fc.format, resultBytes, fc.opts)
+}
+
+func (fc *fdContent) metadata() map[string]interface{} {
+	return map[string]interface{}{"fd": float64(fc.fd)}
+}
+
 type functionContent struct {
 	function  string
+	format    inputFormat
 	rawOutput bool
 	rawInput  bool
+	// result functions return {stdout, exitCode, durationMs} rather
+	// than failing if the command does
+	result bool
+	// script, if set, is an executable run directly (from -@path)
+	// rather than a command line split on spaces
+	script string
+	// command, if set, is the command line from a -functions manifest or
+	// an inline JSON argv (e.g. -'["cmd", "a b"]')
+	command []string
+	// commandErr is why an inline JSON argv couldn't be parsed
+	commandErr error
+	env        []string // extra KEY=value environment entries
+	timeout    time.Duration
+	// coprocess functions start the command once and send it each call
+	// as a line of JSON (see coprocess.go)
+	coprocess bool
+	proc      *coprocess
+	// name is the context key the function was loaded as, if any
+	name string
+	opts *loadOptions
+}
+
+func newFunctionContent(format inputFormat, function string, rawOutput bool, result bool, opts *loadOptions) *functionContent {
+	fc := &functionContent{
+		function:  function,
+		format:    format,
+		rawInput:  format == textFormat,
+		rawOutput: rawOutput,
+		result:    result,
+		opts:      opts,
+	}
+	if strings.HasPrefix(function, "&") {
+		fc.coprocess = true
+		fc.function = function[1:]
+	}
+	if isArgv(fc.function) {
+		fc.command, fc.commandErr = parseArgv(fc.function)
+	} else if strings.HasPrefix(fc.function, "@") {
+		fc.script = opts.resolve(fc.function[1:])
+		if !strings.ContainsRune(fc.script, filepath.Separator) {
+			// otherwise exec would look for it in $PATH
+			fc.script = "." + string(filepath.Separator) + fc.script
+		}
+	}
+	return fc
 }
 
 type textContent struct {
 	format inputFormat
 	text   string
+	opts   *loadOptions
 }
 
 func (tc *textContent) load() (interface{}, error) {
-	return loadBytes(tc.format, []byte(tc.text))
+	return loadBytes(tc.format, []byte(tc.text), tc.opts)
 }
 
 func (tc *textContent) metadata() map[string]interface{} {
@@ -254,98 +915,166 @@ func (tc *textContent) metadata() map[string]interface{} {
 }
 
 func (fc *functionContent) load() (interface{}, error) {
-	var f interface{}
-	commandArray := strings.Split(fc.function, " ")
+	if fc.commandErr != nil {
+		return nil, fmt.Errorf("function %s: %s", fc.displayName(), fc.commandErr)
+	}
+	if fc.script != "" {
+		if err := fc.checkScript(); err != nil {
+			return nil, err
+		}
+	}
 
-	if fc.rawInput && fc.rawOutput {
-		f = func(args []interface{}, stdin string) (string, error) {
-			stringArgs, err := castToStrings(args)
-			if err != nil {
-				return "", err
+	var f interface{}
+	if fc.coprocess {
+		if fc.rawInput {
+			f = func(args []interface{}, stdin string) (interface{}, error) {
+				return fc.callCoprocess(args, stdin)
 			}
-			extendedCommandArray := append(commandArray, stringArgs...)
-			command := exec.Command(extendedCommandArray[0], extendedCommandArray[1:]...)
-			command.Stderr = os.Stderr
-			command.Stdin = bytes.NewReader([]byte(stdin))
-			stdoutBytes, err := command.Output()
-			if err != nil {
-				return "", err
+		} else {
+			f = func(args []interface{}, stdin interface{}) (interface{}, error) {
+				return fc.callCoprocess(args, stdin)
 			}
-			return string(stdoutBytes), nil
 		}
 	} else if fc.rawInput {
 		f = func(args []interface{}, stdin string) (interface{}, error) {
-			stringArgs, err := castToStrings(args)
-			if err != nil {
-				return "", err
-			}
-			extendedCommandArray := append(commandArray, stringArgs...)
-			command := exec.Command(extendedCommandArray[0], extendedCommandArray[1:]...)
-			command.Stderr = os.Stderr
-			command.Stdin = bytes.NewReader([]byte(stdin))
-			stdoutBytes, err := command.Output()
+			return fc.call(args, []byte(stdin))
+		}
+	} else {
+		f = func(args []interface{}, stdin interface{}) (interface{}, error) {
+			jsonBytes, err := json.Marshal(stdin)
 			if err != nil {
 				return nil, err
 			}
+			return fc.call(args, jsonBytes)
+		}
+	}
 
-			var o interface{}
-			err = yaml_ghodss.Unmarshal(stdoutBytes, &o)
-			if err != nil {
-				return nil, err
-			}
-			return o, nil
+	return jsone_interpreter.WrapFunction(f), nil
+}
+
+// call runs the command with args appended, converting its output
+// as requested.
+func (fc *functionContent) call(args []interface{}, stdin []byte) (interface{}, error) {
+	stringArgs, err := castToStrings(args, fc.opts.strictFunctionArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	command := fc.buildCommand(stringArgs)
+	command.Stdin = bytes.NewReader(stdin)
+	var stdout bytes.Buffer
+	command.Stdout = &stdout
+
+	if fc.result {
+		start := time.Now()
+		err := fc.run(command)
+		duration := time.Since(start)
+		exitCode := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.Sys().(syscall.WaitStatus).ExitStatus()
+		} else if err != nil {
+			return nil, err
 		}
-	} else if fc.rawOutput {
-		f = func(args []interface{}, stdin interface{}) (string, error) {
-			jsonBytes, err := json.Marshal(stdin)
-			if err != nil {
-				return "", err
-			}
+		return map[string]interface{}{
+			"stdout":     stdout.String(),
+			"exitCode":   float64(exitCode),
+			"durationMs": float64(duration) / float64(time.Millisecond),
+		}, nil
+	}
 
-			stringArgs, err := castToStrings(args)
-			if err != nil {
-				return "", err
+	if err := fc.run(command); err != nil {
+		return nil, err
+	}
+	stdoutBytes := stdout.Bytes()
+
+	if fc.rawOutput {
+		return string(stdoutBytes), nil
+	}
+
+	if fc.opts.strictFunctions {
+		o, err := loadBytes(fc.format, stdoutBytes, &loadOptions{})
+		if err == nil && fc.format == yamlFormat {
+			// YAML reads most garbage (e.g. a log line followed by a
+			// document) as a plain multi-line string
+			if _, ok := o.(string); ok && bytes.Count(bytes.TrimSpace(stdoutBytes), []byte("\n")) > 0 {
+				err = errors.New("output is several lines of text, not a document (is the command logging to stdout?)")
 			}
-			extendedCommandArray := append(commandArray, stringArgs...)
-			command := exec.Command(extendedCommandArray[0], extendedCommandArray[1:]...)
-			command.Stderr = os.Stderr
-			command.Stdin = bytes.NewReader(jsonBytes)
-			stdoutBytes, err := command.Output()
-			return string(stdoutBytes), err
 		}
+		if err != nil {
+			return nil, fmt.Errorf("function %s: output is not valid %s: %s", fc.displayName(), fc.format, err)
+		}
+		return o, nil
+	}
+
+	return unmarshalYAML(stdoutBytes)
+}
+
+// buildCommand returns the function's command with args appended.
+func (fc *functionContent) buildCommand(args []string) *exec.Cmd {
+	var command *exec.Cmd
+	if fc.script != "" {
+		command = exec.Command(fc.script, args...)
+	} else if fc.command != nil {
+		command = exec.Command(fc.command[0], append(fc.command[1:len(fc.command):len(fc.command)], args...)...)
+	} else if fc.opts.execShell {
+		command = shellCommand(fc.function, args)
 	} else {
-		f = func(args []interface{}, stdin interface{}) (interface{}, error) {
-			jsonBytes, err := json.Marshal(stdin)
-			if err != nil {
-				return "", err
-			}
+		commandArray := strings.Split(fc.function, " ")
+		extendedCommandArray := append(commandArray, args...)
+		command = exec.Command(extendedCommandArray[0], extendedCommandArray[1:]...)
+	}
+	command.Stderr = os.Stderr
+	if fc.env != nil || fc.opts.functionEnvAllowlist != nil {
+		command.Env = append(fc.opts.functionEnviron(), fc.env...)
+	}
+	return command
+}
 
-			stringArgs, err := castToStrings(args)
-			if err != nil {
-				return "", err
-			}
-			extendedCommandArray := append(commandArray, stringArgs...)
-			command := exec.Command(extendedCommandArray[0], extendedCommandArray[1:]...)
-			command.Stderr = os.Stderr
-			command.Stdin = bytes.NewReader(jsonBytes)
-			stdoutBytes, err := command.Output()
-			if err != nil {
-				return nil, err
-			}
+// run runs the command, killing it if it takes longer than the timeout.
+func (fc *functionContent) run(command *exec.Cmd) error {
+	if fc.opts.execSlots != nil {
+		fc.opts.execSlots <- struct{}{}
+		defer func() { <-fc.opts.execSlots }()
+	}
 
-			var o interface{}
-			err = yaml_ghodss.Unmarshal(stdoutBytes, &o)
-			if err != nil {
-				return nil, err
-			}
-			return stdin, nil
-		}
+	if fc.timeout == 0 {
+		return command.Run()
 	}
+	if err := command.Start(); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(fc.timeout, func() {
+		command.Process.Kill()
+	})
+	err := command.Wait()
+	if !timer.Stop() {
+		return fmt.Errorf("function %s timed out after %s", fc.function, fc.timeout)
+	}
+	return err
+}
 
-	return jsone_interpreter.WrapFunction(f), nil
+// checkScript makes sure a script function can be run, so that a
+// missing script is found when the context loads rather than when
+// the template first calls it.
+func (fc *functionContent) checkScript() error {
+	resolved, err := fc.opts.confine(fc.script)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("function script %s is not an executable file", fc.script)
+	}
+	return nil
 }
 
 func (fc *functionContent) metadata() map[string]interface{} {
+	if fc.script != "" {
+		return map[string]interface{}{"script": fc.script}
+	}
 	return map[string]interface{}{}
 }
 
@@ -353,47 +1082,152 @@ type listContent struct {
 	contexts     []context
 	showMetadata bool
 	childFormat  inputFormat
+	// explicitFormat is set if the list was given a format (rather than
+	// defaulting to YAML), which -auto-format doesn't override
+	explicitFormat bool
 }
 
 func (lc *listContent) load() (interface{}, error) {
 	outputList := make([]interface{}, 0, len(lc.contexts))
 
 	for _, context := range lc.contexts {
-		result, err := context.eval()
+		expanded, err := expandArchivePattern(context)
 		if err != nil {
 			return nil, err
 		}
 
-		if !lc.showMetadata {
-			outputList = append(outputList, result)
-			continue
-		}
+		for _, context := range expanded {
+			result, err := context.eval()
+			if err != nil {
+				return nil, err
+			}
 
-		metadataResult := map[string]interface{}{
-			"content": result,
-		}
-		err = mergo.Merge(&metadataResult, context.content.metadata())
-		if err != nil {
-			return nil, err
+			if !lc.showMetadata {
+				outputList = append(outputList, result)
+				continue
+			}
+
+			metadataResult := map[string]interface{}{
+				"content": result,
+			}
+			err = mergo.Merge(&metadataResult, context.content.metadata())
+			if err != nil {
+				return nil, err
+			}
+			outputList = append(outputList, metadataResult)
 		}
-		outputList = append(outputList, metadataResult)
 	}
 
 	return outputList, nil
 }
 
+// expandArchivePattern turns a list element that's an archive pattern
+// (e.g. bundle.zip!manifests/*.yaml) into an element for each matching
+// member. Other elements are returned as they are.
+func expandArchivePattern(c context) ([]context, error) {
+	pc, hasPointer := c.content.(*pointerContent)
+	inner := c.content
+	if hasPointer {
+		inner = pc.content
+	}
+	ac, ok := inner.(*archiveContent)
+	if !ok || !isGlob(ac.member) {
+		return []context{c}, nil
+	}
+
+	members, err := ac.expand()
+	if err != nil {
+		return nil, err
+	}
+	expanded := make([]context, len(members))
+	for i, member := range members {
+		expanded[i] = c
+		if hasPointer {
+			expanded[i].content = &pointerContent{pointer: pc.pointer, content: member}
+		} else {
+			expanded[i].content = member
+		}
+	}
+	return expanded, nil
+}
+
 func (lc *listContent) metadata() map[string]interface{} {
 	return map[string]interface{}{}
 }
 
-func castToStrings(slice []interface{}) ([]string, error) {
+// pointerContent selects the part of its content's document referred to
+// by a JSON pointer.
+type pointerContent struct {
+	pointer string
+	content content
+}
+
+func (pc *pointerContent) load() (interface{}, error) {
+	result, err := pc.content.load()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := parsePointer(pc.pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = pointerGet(result, tokens)
+	if err != nil {
+		return nil, fmt.Errorf("pointer %s: %s", pc.pointer, err)
+	}
+	return result, nil
+}
+
+func (pc *pointerContent) metadata() map[string]interface{} {
+	return pc.content.metadata()
+}
+
+type patchContent struct {
+	format  inputFormat
+	content content
+}
+
+func (pc *patchContent) load() (interface{}, error) {
+	return pc.content.load()
+}
+
+func (pc *patchContent) metadata() map[string]interface{} {
+	return pc.content.metadata()
+}
+
+// apply the patch to target (which must not be modified).
+func (pc *patchContent) apply(target interface{}) (interface{}, error) {
+	patch, err := pc.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if pc.format == mergePatchFormat {
+		return applyMergePatch(target, patch), nil
+	}
+
+	return applyJSONPatch(target, patch)
+}
+
+// castToStrings converts function arguments to command line arguments.
+// Strings are passed as is, and anything else is JSON encoded (unless strict).
+func castToStrings(slice []interface{}, strict bool) ([]string, error) {
 	result := make([]string, len(slice))
 	for i, v := range slice {
-		s, ok := v.(string)
-		if !ok {
-			return nil, errors.New("function command line arguments must be strings (use stdin or $json)")
+		if s, ok := v.(string); ok {
+			result[i] = s
+			continue
+		}
+		if strict {
+			return nil, fmt.Errorf("function command line argument %d is %s, not a string (use stdin or $json, or drop -strict-function-args)", i+1, describeType(v))
+		}
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
 		}
-		result[i] = s
+		result[i] = string(encoded)
 	}
 	return result, nil
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExecParallelism(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	const limit = 3
+	const calls = 8
+
+	// each call logs when its command starts and ends, so the log shows
+	// how many were running at once
+	log := filepath.Join(t.TempDir(), "log")
+	fc := &functionContent{
+		command:   []string{"sh", "-c", `echo start >> "$1"; sleep 0.2; echo end >> "$1"`, "sh"},
+		rawOutput: true,
+		opts:      &loadOptions{execSlots: make(chan struct{}, limit)},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, calls)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fc.call([]interface{}{log}, nil); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, peak := 0, 0
+	for _, line := range strings.Fields(string(data)) {
+		if line == "start" {
+			running++
+		} else {
+			running--
+		}
+		if running > peak {
+			peak = running
+		}
+	}
+	if peak > limit {
+		t.Errorf("%d commands ran at once, but the limit is %d", peak, limit)
+	}
+	if peak < 2 {
+		t.Errorf("commands never ran at the same time (peak %d)", peak)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// coprocess is a long running function command. Each call is written
+// to its stdin as a line of JSON ({"args": [...], "stdin": ...}), and it
+// must reply with a line of JSON on stdout: either {"result": ...} or
+// {"error": "..."}.
+type coprocess struct {
+	name    string
+	command *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+	broken  error
+}
+
+type coprocessRequest struct {
+	Args  []interface{} `json:"args"`
+	Stdin interface{}   `json:"stdin"`
+}
+
+type coprocessResponse struct {
+	Result interface{} `json:"result"`
+	Error  *string     `json:"error"`
+}
+
+// displayName is how the function is referred to in errors.
+func (fc *functionContent) displayName() string {
+	if fc.name != "" {
+		return fc.name
+	}
+	return fc.function
+}
+
+// callCoprocess sends the call to the function's coprocess (starting it
+// if this is the first call) and returns its result.
+func (fc *functionContent) callCoprocess(args []interface{}, stdin interface{}) (interface{}, error) {
+	if fc.proc == nil {
+		proc, err := startCoprocess(fc.displayName(), fc.buildCommand(nil))
+		if err != nil {
+			return nil, err
+		}
+		fc.proc = proc
+		fc.opts.coprocesses = append(fc.opts.coprocesses, proc)
+	}
+	return fc.proc.call(args, stdin)
+}
+
+func startCoprocess(name string, command *exec.Cmd) (*coprocess, error) {
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := command.Start(); err != nil {
+		return nil, fmt.Errorf("function %s: %s", name, err)
+	}
+	return &coprocess{
+		name:    name,
+		command: command,
+		stdin:   stdin,
+		stdout:  bufio.NewReader(stdout),
+	}, nil
+}
+
+func (p *coprocess) call(args []interface{}, stdin interface{}) (interface{}, error) {
+	if p.broken != nil {
+		return nil, p.broken
+	}
+
+	if args == nil {
+		args = []interface{}{}
+	}
+	request, err := json.Marshal(coprocessRequest{Args: args, Stdin: stdin})
+	if err != nil {
+		return nil, fmt.Errorf("function %s: %s", p.name, err)
+	}
+	if _, err := p.stdin.Write(append(request, '\n')); isBrokenPipe(err) {
+		return nil, p.fail("coprocess exited without responding")
+	} else if err != nil {
+		return nil, p.fail("could not send request: %s", err)
+	}
+
+	line, err := p.stdout.ReadBytes('\n')
+	if err == io.EOF {
+		return nil, p.fail("coprocess exited without responding")
+	} else if err != nil {
+		return nil, p.fail("could not read response: %s", err)
+	}
+
+	var response coprocessResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return nil, p.fail("invalid response %q: %s", strings.TrimSpace(string(line)), err)
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("function %s: %s", p.name, *response.Error)
+	}
+	return response.Result, nil
+}
+
+// isBrokenPipe reports whether err is from writing to a pipe whose
+// reader has exited.
+func isBrokenPipe(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+	return err == syscall.EPIPE
+}
+
+// fail kills the coprocess after a protocol error, since we can no
+// longer tell which response belongs to which request.
+func (p *coprocess) fail(format string, a ...interface{}) error {
+	p.broken = fmt.Errorf("function %s: %s", p.name, fmt.Sprintf(format, a...))
+	p.command.Process.Kill()
+	p.command.Wait()
+	return p.broken
+}
+
+// stop closes the coprocess's stdin and waits for it to exit.
+func (p *coprocess) stop() error {
+	if p.broken != nil {
+		return nil
+	}
+	p.stdin.Close()
+	if err := p.command.Wait(); err != nil {
+		return fmt.Errorf("function %s: coprocess failed: %s", p.name, err)
+	}
+	return nil
+}
+
+// stopCoprocesses stops every coprocess started while rendering.
+func (opts *loadOptions) stopCoprocesses() error {
+	var firstErr error
+	for _, p := range opts.coprocesses {
+		if err := p.stop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	opts.coprocesses = nil
+	return firstErr
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// writeCSV writes a list of flat objects as CSV, with a header row of
+// all the keys (sorted). Missing keys and nulls are empty cells.
+func writeCSV(out io.Writer, output interface{}) error {
+	rows, ok := output.([]interface{})
+	if !ok {
+		return fmt.Errorf("csv output requires a list of objects, not %s", describeType(output))
+	}
+
+	keySet := make(map[string]bool)
+	for i, row := range rows {
+		rowMap, ok := row.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("csv output requires a list of objects, but item %d is %s", i, describeType(row))
+		}
+		for k := range rowMap {
+			keySet[k] = true
+		}
+	}
+	keys := make([]string, 0, len(keySet))
+	for k := range keySet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w := csv.NewWriter(out)
+	if err := w.Write(keys); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		rowMap := row.(map[string]interface{})
+		record := make([]string, len(keys))
+		for j, k := range keys {
+			cell, err := csvCell(rowMap[k])
+			if err != nil {
+				return fmt.Errorf("csv output item %d key %q: %s", i, k, err)
+			}
+			record[j] = cell
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func csvCell(v interface{}) (string, error) {
+	switch typedV := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return typedV, nil
+	case map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("cannot put %s in a csv cell", describeType(v))
+	default:
+		cell, err := json.Marshal(v)
+		return string(cell), err
+	}
+}
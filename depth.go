@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// checkDepth returns an error if v is nested more than maxDepth levels
+// deep (0 means unlimited), naming the path where the limit was hit.
+func checkDepth(v interface{}, maxDepth int) error {
+	if maxDepth <= 0 {
+		return nil
+	}
+	return checkDepthAt(v, maxDepth, nil)
+}
+
+func checkDepthAt(v interface{}, remaining int, path []string) error {
+	switch typedV := v.(type) {
+	case map[string]interface{}:
+		if remaining == 0 {
+			return fmt.Errorf("exceeded maximum depth at %s", formatPointer(path))
+		}
+		// sorted so the error is the same every time
+		for _, k := range sortedKeys(typedV) {
+			if err := checkDepthAt(typedV[k], remaining-1, append(path, k)); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if remaining == 0 {
+			return fmt.Errorf("exceeded maximum depth at %s", formatPointer(path))
+		}
+		for i, child := range typedV {
+			if err := checkDepthAt(child, remaining-1, append(path, strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// renderTwice renders the template with r and then with second, which
+// has a freshly loaded context (-assert-deterministic), returning the
+// output if they're byte for byte the same. If they're not, the error
+// says which document differs first, followed by a diff of the two.
+func (r *renderer) renderTwice(input io.Reader, second *renderer) ([]byte, error) {
+	template, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var first, again bytes.Buffer
+	r.recordEnds = true
+	if err := r.render(&first, bytes.NewReader(template)); err != nil {
+		return nil, err
+	}
+	if err := second.render(&again, bytes.NewReader(template)); err != nil {
+		return nil, fmt.Errorf("-assert-deterministic: rendering again: %s", err)
+	}
+	if bytes.Equal(first.Bytes(), again.Bytes()) {
+		return first.Bytes(), nil
+	}
+
+	// everything before the first difference is the same, so the
+	// documents that end there are too
+	offset := int64(commonPrefixLength(first.Bytes(), again.Bytes()))
+	document := 1
+	for _, end := range r.documentEnds {
+		if end <= offset {
+			document++
+		}
+	}
+	diff := unifiedDiff("first render", first.Bytes(), "second render", again.Bytes())
+	return nil, fmt.Errorf("output isn't deterministic (-assert-deterministic): document %d differs when rendered again\n%s", document, strings.TrimSuffix(diff, "\n"))
+}
+
+// commonPrefixLength is the number of bytes at the start of a and b that
+// are the same.
+func commonPrefixLength(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff returns a unified diff between a and b, or "" if they
+// are the same.
+func unifiedDiff(aName string, a []byte, bName string, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+
+	ops := diffLines(splitLines(string(a)), splitLines(string(b)))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+
+	// positions (1-based) in a and b of each op
+	aPos, bPos := make([]int, len(ops)), make([]int, len(ops))
+	ai, bi := 1, 1
+	for i, op := range ops {
+		aPos[i], bPos[i] = ai, bi
+		if op.kind != '+' {
+			ai++
+		}
+		if op.kind != '-' {
+			bi++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk until there are more than 2*diffContext
+		// unchanged lines in a row
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for unchanged := 0; end < len(ops) && unchanged <= 2*diffContext; end++ {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		// trim trailing context back to diffContext lines
+		for end > i && ops[end-1].kind == ' ' {
+			end--
+		}
+		end += diffContext
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		aCount, bCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aPos[start], aCount), hunkRange(bPos[start], bCount))
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = end
+	}
+
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// by convention, an empty range refers to the line before
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits s into lines, each keeping its "\n" so that a
+// missing newline at the end is a difference too.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a minimal line diff with Myers' algorithm, using
+// the linear space variant (which splits the problem at the middle of
+// an optimal path) so large outputs don't need a table of every pair of
+// lines.
+func diffLines(a, b []string) []diffOp {
+	return appendDiff(make([]diffOp, 0, len(a)+len(b)), a, b)
+}
+
+func appendDiff(ops []diffOp, a, b []string) []diffOp {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		ops = append(ops, diffOp{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	common := 0
+	for common < len(a) && common < len(b) && a[len(a)-1-common] == b[len(b)-1-common] {
+		common++
+	}
+	suffix := a[len(a)-common:]
+	a, b = a[:len(a)-common], b[:len(b)-common]
+
+	if x, y, ok := middleSnake(a, b); ok {
+		ops = appendDiff(ops, a[:x], b[:y])
+		ops = appendDiff(ops, a[x:], b[y:])
+	} else {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+	}
+
+	for _, line := range suffix {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// middleSnake searches for an optimal path from both ends of a and b at
+// once, returning the point where they meet. ok is false if a and b have
+// no lines in common (or either is empty), so the diff is just deleting
+// a and inserting b.
+func middleSnake(a, b []string) (x, y int, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	// forward[offset+k] is the furthest x reached on diagonal k (x-y)
+	// from the start, and backward[offset+k] is the same from the end
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	delta := n - m
+	// if delta is odd, the paths overlap during a forward step;
+	// otherwise during a backward step
+	odd := delta%2 != 0
+	// diagonals to skip once they've run off the edge
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				bk := offset + delta - k
+				if bk >= 0 && bk < len(backward) && backward[bk] != -1 && x >= n-backward[bk] {
+					return x, y, true
+				}
+			}
+		}
+
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				fk := offset + delta - k
+				if fk >= 0 && fk < len(forward) && forward[fk] != -1 {
+					fx := forward[fk]
+					if fx >= n-x {
+						return fx, offset + fx - fk, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// utf8BOM is the byte order mark that some (mostly Windows) tools start
+// UTF-8 files with.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// encodingError is returned for input that isn't valid UTF-8, which the
+// parsers otherwise report confusingly (or not at all).
+type encodingError struct {
+	// offset of the first invalid byte
+	offset int
+}
+
+func (e *encodingError) Error() string {
+	return fmt.Sprintf("not valid UTF-8 (at byte %d)", e.offset)
+}
+
+// checkEncoding returns data without any byte order mark, or an
+// encodingError if it isn't UTF-8.
+func checkEncoding(data []byte) ([]byte, error) {
+	stripped := bytes.TrimPrefix(data, utf8BOM)
+	if utf8.Valid(stripped) {
+		return stripped, nil
+	}
+	return nil, &encodingError{offset: len(data) - len(stripped) + invalidOffset(stripped)}
+}
+
+// invalidOffset returns the offset of the first byte of data that isn't
+// part of a UTF-8 character.
+func invalidOffset(data []byte) int {
+	offset := 0
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			break
+		}
+		data = data[size:]
+		offset += size
+	}
+	return offset
+}
+
+// utf8Reader is checkEncoding for input that's read as it's decoded
+// (e.g. a -split-items JSON template), failing with an encodingError at
+// the first byte that isn't UTF-8. offset is where r starts in the input
+// (after any byte order mark).
+type utf8Reader struct {
+	r      io.Reader
+	offset int
+	// checked is valid input not yet read, and unchecked the start of a
+	// character that's still being read
+	checked, unchecked []byte
+	err                error
+}
+
+func (u *utf8Reader) Read(p []byte) (int, error) {
+	for len(u.checked) == 0 {
+		if u.err != nil {
+			return 0, u.err
+		}
+		buf := make([]byte, len(u.unchecked), len(u.unchecked)+4096)
+		copy(buf, u.unchecked)
+		n, err := u.r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+
+		end := len(buf)
+		if err == nil {
+			// hold back a character split across reads
+			for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+				if utf8.RuneStart(buf[i]) {
+					if !utf8.FullRune(buf[i:]) {
+						end = i
+					}
+					break
+				}
+			}
+		}
+		if !utf8.Valid(buf[:end]) {
+			end = invalidOffset(buf)
+			err = &encodingError{offset: u.offset + end}
+		}
+		u.checked, u.unchecked = buf[:end], buf[end:]
+		u.offset += end
+		u.err = err
+	}
+	n := copy(p, u.checked)
+	u.checked = u.checked[n:]
+	return n, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+)
+
+// envFactsContent is facts about the environment rjsone is running in
+// (-inject-env-facts), so templates don't need them passed as separate
+// contexts with ad hoc names.
+type envFactsContent struct{}
+
+func (ec *envFactsContent) load() (interface{}, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("-inject-env-facts: %s", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("-inject-env-facts: %s", err)
+	}
+	// the user isn't always known (e.g. a uid without a passwd entry in a
+	// container), which just leaves it empty
+	username := ""
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+
+	return map[string]interface{}{
+		"host": host,
+		"cwd":  cwd,
+		"pid":  float64(os.Getpid()),
+		"ppid": float64(os.Getppid()),
+		"uid":  float64(os.Getuid()),
+		"gid":  float64(os.Getgid()),
+		"user": username,
+		"os":   runtime.GOOS,
+		"arch": runtime.GOARCH,
+	}, nil
+}
+
+func (ec *envFactsContent) metadata() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+// envFactsFlag is -inject-env-facts, which can be given alone (for the
+// key rjsone) or as -inject-env-facts=key.
+type envFactsFlag string
+
+// IsBoolFlag lets -inject-env-facts be given without a value.
+func (e *envFactsFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (e *envFactsFlag) String() string {
+	return string(*e)
+}
+
+func (e *envFactsFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*e = "rjsone"
+	case "false":
+		*e = ""
+	default:
+		// the key is checked by run, as for -git-context
+		*e = envFactsFlag(value)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// explanation is how a context argument was parsed (-explain): its
+// fields, in the order they're shown, and the members of a list.
+type explanation struct {
+	argument string
+	fields   []explainField
+	items    []explanation
+}
+
+type explainField struct {
+	name  string
+	value interface{}
+}
+
+func (e *explanation) add(name string, value interface{}) {
+	e.fields = append(e.fields, explainField{name, value})
+}
+
+// explainContext describes a parsed context without loading it.
+func explainContext(c context) explanation {
+	e := explanation{argument: c.original}
+	e.add("kind", contentKind(c.content))
+	switch {
+	case len(c.path) > 0:
+		e.add("path", c.path)
+	case c.key != "":
+		e.add("key", c.key)
+	}
+	if c.deepMerge {
+		e.add("deepMerge", true)
+	}
+	explainContent(&e, c.content)
+	if len(c.transforms) > 0 {
+		e.add("transforms", c.transforms)
+	}
+	if c.transform != nil {
+		explainTransform(&e, c.transform)
+	}
+	return e
+}
+
+// contentKind is the kind of source content is read from, looking
+// through the wrappers that only change what's done with it.
+func contentKind(c content) string {
+	switch typedC := c.(type) {
+	case *fileContent:
+		return "file"
+	case *stdinContent:
+		return "stdin"
+	case *fdContent:
+		return "fd"
+	case *textContent:
+		return "text"
+	case *functionContent:
+		return "function"
+	case *listContent:
+		return "list"
+	case *archiveContent:
+		return "archive"
+	case *uriContent:
+		return "uri"
+	case *storeContent:
+		return "store"
+	case *gitContent:
+		return "git"
+	case *envFactsContent:
+		return "envFacts"
+	case *pointerContent:
+		return contentKind(typedC.content)
+	case *patchContent:
+		return contentKind(typedC.content)
+	case *contextJSONContent:
+		return contentKind(typedC.content)
+	default:
+		return fmt.Sprintf("%T", c)
+	}
+}
+
+func explainContent(e *explanation, c content) {
+	switch typedC := c.(type) {
+	case *fileContent:
+		e.add("format", string(typedC.format))
+		e.add("file", typedC.filename)
+	case *stdinContent:
+		e.add("format", string(typedC.format))
+	case *fdContent:
+		e.add("format", string(typedC.format))
+		e.add("descriptor", typedC.descriptor)
+	case *textContent:
+		e.add("format", string(typedC.format))
+		e.add("text", typedC.text)
+	case *functionContent:
+		e.add("format", string(typedC.format))
+		switch {
+		case typedC.script != "":
+			e.add("script", typedC.script)
+		case typedC.command != nil:
+			e.add("command", typedC.command)
+		default:
+			e.add("command", typedC.function)
+		}
+		if typedC.commandErr != nil {
+			e.add("error", typedC.commandErr.Error())
+		}
+		e.add("rawOutput", typedC.rawOutput)
+		if typedC.result {
+			e.add("result", true)
+		}
+		if typedC.coprocess {
+			e.add("coprocess", true)
+		}
+	case *listContent:
+		e.add("format", string(typedC.childFormat))
+		e.add("metadata", typedC.showMetadata)
+		e.items = make([]explanation, 0, len(typedC.contexts))
+		for _, item := range typedC.contexts {
+			e.items = append(e.items, explainContext(item))
+		}
+	case *archiveContent:
+		e.add("format", string(typedC.format))
+		e.add("archive", typedC.archive)
+		e.add("member", typedC.member)
+	case *uriContent:
+		e.add("format", string(typedC.format))
+		e.add("scheme", typedC.scheme)
+		e.add("resource", typedC.resource)
+	case *storeContent:
+		e.add("format", string(typedC.format))
+		e.add("resource", typedC.path)
+	case *gitContent:
+		e.add("optional", typedC.optional)
+	case *pointerContent:
+		explainContent(e, typedC.content)
+		e.add("pointer", typedC.pointer)
+	case *patchContent:
+		explainContent(e, typedC.content)
+		e.add("patch", string(typedC.format))
+	case *contextJSONContent:
+		explainContent(e, typedC.content)
+	}
+}
+
+func explainTransform(e *explanation, kt *keyTransform) {
+	var renames []string
+	for _, rename := range kt.renames {
+		renames = append(renames, rename[0]+"="+rename[1])
+	}
+	for _, field := range []explainField{
+		{"renames", renames},
+		{"pick", kt.pick},
+		{"drop", kt.drop},
+		{"keyCase", kt.keyCase},
+		{"keyPrefix", kt.prefix},
+	} {
+		switch value := field.value.(type) {
+		case []string:
+			if len(value) > 0 {
+				e.add(field.name, value)
+			}
+		case string:
+			if value != "" {
+				e.add(field.name, value)
+			}
+		}
+	}
+	if kt.recursive {
+		e.add("recursive", true)
+	}
+}
+
+// explainFlag is -explain, which can be given alone (for text) or as
+// -explain=json or -explain=yaml for a structured version.
+type explainFlag string
+
+// IsBoolFlag lets -explain be given without a value.
+func (e *explainFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (e *explainFlag) String() string {
+	return string(*e)
+}
+
+func (e *explainFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*e = "text"
+	case "false":
+		*e = ""
+	default:
+		// the format is checked by validateArgs, since flag would
+		// describe a bad value here as an invalid boolean
+		*e = explainFlag(value)
+	}
+	return nil
+}
+
+// structured is the explanation as an object, for JSON or YAML: its
+// fields, the argument, and (for a list) its items.
+func (e explanation) structured() map[string]interface{} {
+	result := map[string]interface{}{"argument": e.argument}
+	for _, field := range e.fields {
+		result[field.name] = field.value
+	}
+	if e.items != nil {
+		items := make([]interface{}, 0, len(e.items))
+		for _, item := range e.items {
+			items = append(items, item.structured())
+		}
+		result["items"] = items
+	}
+	return result
+}
+
+// printExplanation writes how each context was parsed in format. As text,
+// that's each argument followed by its fields, with the members of lists
+// indented beneath them. As JSON or YAML, it's a list of objects.
+func printExplanation(w io.Writer, contexts []context, format explainFlag) (finalError error) {
+	explanations := make([]explanation, 0, len(contexts))
+	for _, c := range contexts {
+		explanations = append(explanations, explainContext(c))
+	}
+	if format == "text" {
+		return printExplanations(w, explanations, "")
+	}
+
+	structured := make([]interface{}, 0, len(explanations))
+	for _, e := range explanations {
+		structured = append(structured, e.structured())
+	}
+	if format == "yaml" {
+		encoder := newYAMLEncoder(w, "")
+		defer func() {
+			if err := encoder.Close(); err != nil && finalError == nil {
+				finalError = err
+			}
+		}()
+		return encoder.Encode(structured)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(structured)
+}
+
+func printExplanations(w io.Writer, explanations []explanation, indent string) error {
+	width := 0
+	for _, e := range explanations {
+		if len(e.argument) > width {
+			width = len(e.argument)
+		}
+	}
+	for _, e := range explanations {
+		var fields []string
+		for _, field := range e.fields {
+			fields = append(fields, field.name+"="+formatExplainValue(field.value))
+		}
+		if _, err := fmt.Fprintf(w, "%s%-*s  %s\n", indent, width, e.argument, strings.Join(fields, " ")); err != nil {
+			return err
+		}
+		if err := printExplanations(w, e.items, indent+"  "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatExplainValue formats a field's value so that it's unambiguous on
+// one line, quoting strings that would otherwise run into the next field.
+func formatExplainValue(value interface{}) string {
+	switch typedValue := value.(type) {
+	case string:
+		if typedValue == "" || strings.ContainsAny(typedValue, " \t\n\"=") {
+			return strconv.Quote(typedValue)
+		}
+		return typedValue
+	case []string:
+		encoded, _ := json.Marshal(typedValue)
+		return string(encoded)
+	default:
+		return fmt.Sprint(typedValue)
+	}
+}
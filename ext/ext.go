@@ -0,0 +1,66 @@
+// Package ext is how Go code adds to rjsone in-process. Plugins
+// loaded with -plugin can import it to register functions for templates,
+// or to have files read from an fs.FS.
+package ext
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+
+	jsone_interpreter "github.com/taskcluster/json-e/interpreter"
+)
+
+var identifierRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// functions are the registered functions, by name.
+var functions = make(map[string]interface{})
+
+// RegisterFunction makes a Go function available to templates under name.
+// fn must be a function json-e can call (see jsone_interpreter.WrapFunction).
+// A context key with the same name takes precedence.
+func RegisterFunction(name string, fn interface{}) (err error) {
+	defer func() {
+		// WrapFunction panics on unsupported functions
+		if r := recover(); r != nil {
+			err = fmt.Errorf("function %s: %v", name, r)
+		}
+	}()
+	if !identifierRegexp.MatchString(name) {
+		return fmt.Errorf("function name %q is not a valid identifier", name)
+	}
+	functions[name] = jsone_interpreter.WrapFunction(fn)
+	return nil
+}
+
+// Function returns the function registered under name.
+func Function(name string) (fn interface{}, ok bool) {
+	fn, ok = functions[name]
+	return fn, ok
+}
+
+// Functions returns the names of the registered functions, sorted.
+func Functions() []string {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// filesystem is the filesystem set by SetFS.
+var filesystem fs.FS
+
+// SetFS makes rjsone read context files, templates and includes from
+// fsys (e.g. an embed.FS) instead of the OS's filesystem. Function
+// commands still run from the OS's filesystem.
+func SetFS(fsys fs.FS) {
+	filesystem = fsys
+}
+
+// FS returns the filesystem set by SetFS, or nil if there isn't one.
+func FS() fs.FS {
+	return filesystem
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// formatLoader parses context data in a particular input format.
+type formatLoader struct {
+	description string
+	load        func(data []byte) (interface{}, error)
+}
+
+// inputFormats are the formats loadBytes understands. The kv format can
+// also have separators appended (see parseKVSeparators), and the patch
+// formats are handled separately since they don't produce a context.
+var inputFormats = map[inputFormat]formatLoader{
+	yamlFormat: {"YAML (the default)", func(data []byte) (interface{}, error) {
+		return unmarshalYAML(data)
+	}},
+	jsonFormat: {"JSON", func(data []byte) (interface{}, error) {
+		var result interface{}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}},
+	textFormat: {"plain text string (the default with ::)", func(data []byte) (interface{}, error) {
+		return string(data), nil
+	}},
+	kvFormat: {"key value pairs, one per line, space separated (kv<record sep><field sep> for others)", func(data []byte) (interface{}, error) {
+		return parseKV(data, "\n", " ")
+	}},
+	prototextFormat:   {"protobuf text format (repeated fields become lists)", parsePrototext},
+	frontmatterFormat: {"YAML front matter between --- lines (e.g. in Markdown), with the rest of the file as content", parseFrontmatter},
+	ndjsonFormat:      {"JSON Lines (NDJSON): a JSON value per line, as a list", parseNDJSON},
+}
+
+var patchFormats = map[inputFormat]string{
+	jsonPatchFormat:  "RFC 6902 JSON Patch applied to the context so far",
+	mergePatchFormat: "RFC 7386 JSON Merge Patch applied to the context so far",
+}
+
+// formatExtensions are the formats -auto-format infers from extensions.
+var formatExtensions = map[string]inputFormat{
+	".yaml":      yamlFormat,
+	".yml":       yamlFormat,
+	".json":      jsonFormat,
+	".txt":       textFormat,
+	".env":       inputFormat(`kv\n=`),
+	".textproto": prototextFormat,
+	".md":        frontmatterFormat,
+	".jsonl":     ndjsonFormat,
+	".ndjson":    ndjsonFormat,
+	".pbtxt":     prototextFormat,
+}
+
+// formatFromExtension returns the format -auto-format uses for a filename
+// or URI, if there's one for its extension. Raw text, functions and stdin
+// have no extension.
+func formatFromExtension(data string) (inputFormat, bool) {
+	format, ok := formatExtensions[extension(data)]
+	return format, ok
+}
+
+// extension returns the lower case extension (with its dot) of a filename
+// or URI, or "" if it doesn't have one.
+func extension(data string) string {
+	if strings.HasPrefix(data, "+") || strings.HasPrefix(data, "-") {
+		return ""
+	}
+	source, _, _ := splitPointer(data)
+	return strings.ToLower(filepath.Ext(source))
+}
+
+// isTextFile reports whether data is a file (or URI) with one of the
+// -text-extensions, which is read as text unless it's given a format.
+func (opts *loadOptions) isTextFile(data string) bool {
+	ext := extension(data)
+	return ext != "" && opts.textExtensions[ext]
+}
+
+// parseTextExtensions parses -text-extensions, a comma separated list
+// of extensions with or without their dot (e.g. .sh,pem).
+func parseTextExtensions(list string) (map[string]bool, error) {
+	extensions := make(map[string]bool)
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if ext == "." || strings.ContainsAny(ext[1:], `./\`) {
+			return nil, fmt.Errorf("-text-extensions: %q isn't an extension", strings.TrimSpace(strings.TrimPrefix(ext, ".")))
+		}
+		extensions[ext] = true
+	}
+	return extensions, nil
+}
+
+// outputFormats are the values of -f.
+var outputFormats = map[string]string{
+	"json": "JSON (the default; see -i)",
+	"yaml": "YAML (same as -y)",
+	"csv":  "CSV, from a list of flat objects",
+}
+
+// printFormats writes the supported input and output formats for -list-formats.
+func printFormats(out io.Writer) error {
+	descriptions := make(map[string]interface{})
+	for format, loader := range inputFormats {
+		descriptions[string(format)] = loader.description
+	}
+	for format, description := range patchFormats {
+		descriptions[string(format)] = description
+	}
+	for format, source := range storeSources {
+		descriptions[string(format)] = source.description
+	}
+
+	if _, err := fmt.Fprintln(out, "Input formats (:format:data):"); err != nil {
+		return err
+	}
+	for _, format := range sortedKeys(descriptions) {
+		if _, err := fmt.Fprintf(out, "  %-12s %s\n", format, descriptions[format]); err != nil {
+			return err
+		}
+	}
+
+	extensions := make(map[string]interface{})
+	for extension, format := range formatExtensions {
+		extensions[extension] = string(format)
+	}
+	if _, err := fmt.Fprintln(out, "Extensions (with -auto-format):"); err != nil {
+		return err
+	}
+	for _, extension := range sortedKeys(extensions) {
+		if _, err := fmt.Fprintf(out, "  %-12s %s\n", extension, extensions[extension]); err != nil {
+			return err
+		}
+	}
+
+	if len(uriSources) > 0 {
+		sources := make(map[string]interface{})
+		for scheme, source := range uriSources {
+			sources[scheme+"://"] = source.description
+		}
+		if _, err := fmt.Fprintln(out, "Sources (in place of a filename):"); err != nil {
+			return err
+		}
+		for _, scheme := range sortedKeys(sources) {
+			if _, err := fmt.Fprintf(out, "  %-12s %s\n", scheme, sources[scheme]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := fmt.Fprintln(out, "YAML tag sets (-yaml-tags):"); err != nil {
+		return err
+	}
+	for _, name := range sortedYAMLTagSets() {
+		if _, err := fmt.Fprintf(out, "  %-12s %s\n", name, yamlTagSets[name].description); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintln(out, "Output formats (-f):"); err != nil {
+		return err
+	}
+	for _, format := range sortedOutputFormats() {
+		if _, err := fmt.Fprintf(out, "  %-12s %s\n", format, outputFormats[format]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedOutputFormats() []string {
+	formats := make([]string, 0, len(outputFormats))
+	for format := range outputFormats {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
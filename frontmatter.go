@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// frontmatterContentKey is the key the body of a front matter file is
+// added under.
+const frontmatterContentKey = "content"
+
+// parseFrontmatter reads a text file (e.g. Markdown) with YAML front
+// matter between --- lines at the start. The result is the front matter
+// with the rest of the file added as content. A file without front
+// matter is all content.
+func parseFrontmatter(data []byte) (interface{}, error) {
+	frontmatter, body, err := splitFrontmatter(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{}
+	if frontmatter != nil {
+		parsed, err := unmarshalYAML(frontmatter)
+		if err != nil {
+			return nil, fmt.Errorf("front matter: %s", err)
+		}
+		switch typedParsed := parsed.(type) {
+		case map[string]interface{}:
+			result = typedParsed
+		case nil:
+		default:
+			return nil, fmt.Errorf("front matter should be a mapping, not %s", describeType(parsed))
+		}
+	}
+
+	if _, ok := result[frontmatterContentKey]; ok {
+		return nil, fmt.Errorf("front matter can't have a %q key, which is used for the body", frontmatterContentKey)
+	}
+	result[frontmatterContentKey] = string(body)
+	return result, nil
+}
+
+// splitFrontmatter returns the front matter (nil if there isn't any) and
+// the body. The front matter ends at a --- (or ...) line.
+func splitFrontmatter(data []byte) ([]byte, []byte, error) {
+	firstLine, rest := splitLine(data)
+	if string(firstLine) != "---" {
+		return nil, data, nil
+	}
+
+	frontmatter := rest
+	for len(rest) > 0 {
+		var line []byte
+		start := len(frontmatter) - len(rest)
+		line, rest = splitLine(rest)
+		if string(line) == "---" || string(line) == "..." {
+			return frontmatter[:start], rest, nil
+		}
+	}
+	return nil, nil, errors.New("front matter has no closing --- line")
+}
+
+// splitLine returns the first line of data (without its line ending) and
+// everything after it.
+func splitLine(data []byte) ([]byte, []byte) {
+	end := bytes.IndexByte(data, '\n')
+	if end == -1 {
+		return bytes.TrimSuffix(data, []byte("\r")), nil
+	}
+	return bytes.TrimSuffix(data[:end], []byte("\r")), data[end+1:]
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+func init() {
+	fsBuiltins["fileExists"] = fileExistsBuiltin
+	fsBuiltins["glob"] = globBuiltin
+	fsBuiltins["readFile"] = readFileBuiltin
+}
+
+// fileExistsBuiltin returns fileExists(path), which is whether path
+// exists (relative to the template's directory with
+// -relative-to-template). A path outside -root is an error, rather than
+// false, so a typo isn't mistaken for a missing file.
+func fileExistsBuiltin(opts *loadOptions) interface{} {
+	return func(filename string) (bool, error) {
+		resolved := opts.resolve(filename)
+		// checked before stat, so it can't tell whether files outside
+		// -root exist
+		if err := opts.confineLexically(resolved); err != nil {
+			return false, fmt.Errorf("fileExists: %s", err)
+		}
+		if _, err := opts.stat(resolved); os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("fileExists: %s", err)
+		}
+		// a symlink may still lead outside
+		if _, err := opts.confine(resolved); err != nil {
+			return false, fmt.Errorf("fileExists: %s", err)
+		}
+		return true, nil
+	}
+}
+
+// globBuiltin returns glob(pattern), which is the sorted paths matching
+// pattern (see filepath.Match), relative to the template's directory as
+// the pattern is with -relative-to-template, so they can be given to
+// readFile.
+func globBuiltin(opts *loadOptions) interface{} {
+	return func(pattern string) ([]interface{}, error) {
+		resolved := opts.resolve(pattern)
+		matches, err := opts.glob(resolved)
+		if err != nil {
+			return nil, fmt.Errorf("glob: %s: %s", resolved, err)
+		}
+		sort.Strings(matches)
+
+		result := make([]interface{}, 0, len(matches))
+		for _, match := range matches {
+			if _, err := opts.confine(match); err != nil {
+				return nil, fmt.Errorf("glob: %s", err)
+			}
+			if opts.baseDir != "" && !filepath.IsAbs(pattern) {
+				if relative, err := filepath.Rel(opts.baseDir, match); err == nil {
+					match = relative
+				}
+			}
+			result = append(result, match)
+		}
+		return result, nil
+	}
+}
+
+// readFileBuiltin returns readFile(path, format), which parses the file
+// at path as format, like a context, or by its extension if format is ""
+// (see inferFileFormat).
+func readFileBuiltin(opts *loadOptions) interface{} {
+	return func(filename string, format string) (interface{}, error) {
+		if format == "" {
+			format = string(inferFileFormat(filename, opts))
+		}
+		data, err := opts.readFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("readFile: %s", err)
+		}
+		result, err := loadBytes(inputFormat(format), data, opts)
+		if err != nil {
+			return nil, fmt.Errorf("readFile: %s: %s", opts.resolve(filename), err)
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// fsName converts a filename to a name in an fs.FS, which is always
+// slash separated and unrooted (so absolute filenames are taken to be
+// relative to the top of the FS).
+func fsName(filename string) (string, error) {
+	name := path.Clean(strings.TrimPrefix(filepath.ToSlash(filename), "/"))
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "open", Path: filename, Err: fs.ErrInvalid}
+	}
+	return name, nil
+}
+
+// open opens a file from fsys, or the OS filesystem if it isn't set.
+func (opts *loadOptions) open(filename string) (io.ReadCloser, error) {
+	if opts.fsys == nil {
+		return os.Open(filename)
+	}
+	name, err := fsName(filename)
+	if err != nil {
+		return nil, err
+	}
+	return opts.fsys.Open(name)
+}
+
+// readRaw reads a file from fsys, or the OS filesystem if it isn't set,
+// without resolving or confining it (see readFile).
+func (opts *loadOptions) readRaw(filename string) ([]byte, error) {
+	if opts.fsys == nil {
+		return ioutil.ReadFile(filename)
+	}
+	name, err := fsName(filename)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(opts.fsys, name)
+}
+
+// stat describes a file in fsys, or the OS filesystem if it isn't set.
+func (opts *loadOptions) stat(filename string) (os.FileInfo, error) {
+	if opts.fsys == nil {
+		return os.Stat(filename)
+	}
+	name, err := fsName(filename)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(opts.fsys, name)
+}
+
+// glob returns the files in fsys (or the OS filesystem if it isn't set)
+// matching pattern. Matches from fsys keep pattern's leading /, so they
+// can be passed back in the same form.
+func (opts *loadOptions) glob(pattern string) ([]string, error) {
+	if opts.fsys == nil {
+		return filepath.Glob(pattern)
+	}
+	name, err := fsName(pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := fs.Glob(opts.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.IsAbs(pattern) {
+		for i, match := range matches {
+			matches[i] = "/" + match
+		}
+	}
+	return matches, nil
+}
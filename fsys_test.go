@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	jsone "github.com/taskcluster/json-e"
+)
+
+var testFS = fstest.MapFS{
+	"contexts/app.yaml":         {Data: []byte("name: web\nreplicas: 2\n")},
+	"contexts/labels.json":      {Data: []byte(`{"team": "platform"}`)},
+	"templates/main.yaml":       {Data: []byte("name: ${name}\nspec: {$rjsone-include: parts/spec.yaml, replicas: {$eval: replicas}}\n")},
+	"templates/parts/spec.yaml": {Data: []byte("image: ${name}:latest\nlabels: {$eval: labels}\n")},
+	"data/a.yaml":               {Data: []byte("a: 1\n")},
+	"data/b.yaml":               {Data: []byte("b: 2\n")},
+}
+
+// renderFromFS renders templateFile with rawContexts, reading everything
+// from fsys.
+func renderFromFS(t *testing.T, fsys fstest.MapFS, templateFile string, rawContexts ...string) (interface{}, error) {
+	t.Helper()
+	opts := &loadOptions{fsys: fsys}
+	contexts, err := parseContexts(rawContexts, opts)
+	if err != nil {
+		return nil, err
+	}
+	context := make(map[string]interface{})
+	for _, c := range contexts {
+		value, err := c.eval()
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range value.(map[string]interface{}) {
+			context[k] = v
+		}
+	}
+
+	template, err := loadTemplateFile(templateFile, opts)
+	if err != nil {
+		return nil, err
+	}
+	template, err = resolveTemplateIncludes(template, templateFile, opts)
+	if err != nil {
+		return nil, err
+	}
+	return jsone.Render(template, context)
+}
+
+func TestRenderFromFS(t *testing.T) {
+	result, err := renderFromFS(t, testFS, "templates/main.yaml", "contexts/app.yaml", "labels:json:contexts/labels.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"name": "web",
+		"spec": map[string]interface{}{
+			"image":    "web:latest",
+			"labels":   map[string]interface{}{"team": "platform"},
+			"replicas": float64(2),
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %#v, expected %#v", result, expected)
+	}
+}
+
+func TestRenderFromFSMissingFile(t *testing.T) {
+	// main.go exists on the OS filesystem, but not in the FS
+	for _, filename := range []string{"main.go", "../main.go", "contexts/missing.yaml"} {
+		if _, err := renderFromFS(t, testFS, "templates/main.yaml", filename); err == nil {
+			t.Errorf("%s: expected an error", filename)
+		}
+	}
+	if _, err := renderFromFS(t, testFS, "main.go"); err == nil {
+		t.Error("main.go template: expected an error")
+	}
+}
+
+func TestRenderFromFSIncludeCycle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.yaml": {Data: []byte("{$rjsone-include: b.yaml}\n")},
+		"b.yaml": {Data: []byte("{$rjsone-include: a.yaml}\n")},
+	}
+	_, err := renderFromFS(t, fsys, "a.yaml")
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("expected an include cycle error, got %v", err)
+	}
+}
+
+func TestFSBuiltins(t *testing.T) {
+	opts := &loadOptions{fsys: testFS}
+
+	glob := globBuiltin(opts).(func(string) ([]interface{}, error))
+	matches, err := glob("data/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{"data/a.yaml", "data/b.yaml"}; !reflect.DeepEqual(matches, expected) {
+		t.Errorf("glob: got %v, expected %v", matches, expected)
+	}
+
+	fileExists := fileExistsBuiltin(opts).(func(string) (bool, error))
+	for filename, expected := range map[string]bool{"data/a.yaml": true, "data/c.yaml": false, "main.go": false} {
+		exists, err := fileExists(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != expected {
+			t.Errorf("fileExists(%s): got %v, expected %v", filename, exists, expected)
+		}
+	}
+
+	readFile := readFileBuiltin(opts).(func(string, string) (interface{}, error))
+	value, err := readFile("data/b.yaml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]interface{}{"b": float64(2)}; !reflect.DeepEqual(value, expected) {
+		t.Errorf("readFile: got %#v, expected %#v", value, expected)
+	}
+}
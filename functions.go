@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// functionSpec is an entry in a -functions manifest.
+type functionSpec struct {
+	Command   []string          `json:"command"`
+	RawInput  bool              `json:"rawInput"`
+	RawOutput bool              `json:"rawOutput"`
+	Env       map[string]string `json:"env"`
+	Timeout   string            `json:"timeout"`
+	Coprocess bool              `json:"coprocess"`
+}
+
+// loadFunctionManifest reads a -functions manifest (a map of function
+// names to functionSpecs) and returns a context for each function,
+// except those named in skip (i.e. also declared positionally).
+func loadFunctionManifest(filename string, skip map[string]bool, opts *loadOptions) ([]context, error) {
+	data, err := opts.readFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := unmarshalYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("function manifest %s: %s", filename, err)
+	}
+	jsonData, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(jsonData, &entries); err != nil {
+		return nil, fmt.Errorf("function manifest %s must be a map of function names to definitions", filename)
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	contexts := make([]context, 0, len(names))
+	for _, name := range names {
+		if skip[name] {
+			continue
+		}
+		fc, err := newManifestFunction(name, entries[name], opts)
+		if err != nil {
+			return nil, fmt.Errorf("function manifest %s: function %s: %s", filename, name, err)
+		}
+		contexts = append(contexts, context{
+			original: fmt.Sprintf("%s (from %s)", name, filename),
+			key:      name,
+			content:  fc,
+		})
+	}
+	return contexts, nil
+}
+
+func newManifestFunction(name string, entry json.RawMessage, opts *loadOptions) (*functionContent, error) {
+	var spec functionSpec
+	decoder := json.NewDecoder(bytes.NewReader(entry))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, err
+	}
+	if len(spec.Command) == 0 {
+		return nil, errors.New("command must be a non-empty list")
+	}
+
+	fc := &functionContent{
+		function:  name,
+		format:    yamlFormat,
+		command:   spec.Command,
+		rawInput:  spec.RawInput,
+		rawOutput: spec.RawOutput,
+		coprocess: spec.Coprocess,
+		opts:      opts,
+	}
+	if spec.Env != nil {
+		keys := make([]string, 0, len(spec.Env))
+		for k := range spec.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fc.env = []string{}
+		for _, k := range keys {
+			fc.env = append(fc.env, k+"="+spec.Env[k])
+		}
+	}
+	if spec.Timeout != "" {
+		timeout, err := time.ParseDuration(spec.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %s", err)
+		}
+		if timeout <= 0 {
+			return nil, errors.New("timeout must be positive")
+		}
+		if spec.Coprocess {
+			return nil, errors.New("timeout can't be used with coprocess")
+		}
+		fc.timeout = timeout
+	}
+	return fc, nil
+}
+
+// isArgv reports whether an inline function is a JSON list of strings
+// (its command and arguments), rather than a command line to split. A
+// bare [ is still the test command.
+func isArgv(function string) bool {
+	trimmed := strings.TrimSpace(function)
+	return strings.HasPrefix(trimmed, "[") && strings.HasPrefix(strings.TrimSpace(trimmed[1:]), `"`)
+}
+
+// parseArgv parses an inline function's JSON argv.
+func parseArgv(function string) ([]string, error) {
+	var list []interface{}
+	if err := json.Unmarshal([]byte(function), &list); err != nil {
+		return nil, fmt.Errorf("command should be a JSON list of strings: %s", err)
+	}
+	argv := make([]string, len(list))
+	for i, arg := range list {
+		s, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("command should be a JSON list of strings, but %d is %s", i, describeType(arg))
+		}
+		argv[i] = s
+	}
+	if argv[0] == "" {
+		return nil, errors.New("command should be a JSON list of strings, starting with the command")
+	}
+	return argv, nil
+}
+
+// functionEnviron is the environment function commands inherit: all of
+// ours, unless -function-env-allowlist limits it.
+func (opts *loadOptions) functionEnviron() []string {
+	environ := os.Environ()
+	if opts.functionEnvAllowlist == nil {
+		return environ
+	}
+
+	allowed := make([]string, 0, len(opts.functionEnvAllowlist))
+	for _, entry := range environ {
+		name := strings.SplitN(entry, "=", 2)[0]
+		for _, allowedName := range opts.functionEnvAllowlist {
+			// environment variable names are case insensitive on Windows
+			if name == allowedName || runtime.GOOS == "windows" && strings.EqualFold(name, allowedName) {
+				allowed = append(allowed, entry)
+				break
+			}
+		}
+	}
+	return allowed
+}
+
+// namesFlag is a comma separated list of names, which can be given more
+// than once. Unlike stringsFlag, giving it at all (even as an empty
+// string) makes it non-nil.
+type namesFlag []string
+
+func (n *namesFlag) String() string {
+	return strings.Join(*n, ",")
+}
+
+func (n *namesFlag) Set(value string) error {
+	if *n == nil {
+		*n = []string{}
+	}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*n = append(*n, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+//go:build gcp
+// +build gcp
+
+package main
+
+import (
+	// aliased since context is already a type in this package
+	gocontext "context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+func init() {
+	uriSources["gs"] = uriSource{
+		description: "Google Cloud Storage object (gs://bucket/key; metadata has bucket, key and etag)",
+		fetch:       fetchGCSObject,
+	}
+}
+
+var (
+	gcsClientOnce sync.Once
+	gcsClient     *storage.Client
+	gcsClientErr  error
+)
+
+// loadGCSClient creates the client the first time a gs:// source is used.
+func loadGCSClient(ctx gocontext.Context) (*storage.Client, error) {
+	gcsClientOnce.Do(func() {
+		gcsClient, gcsClientErr = storage.NewClient(ctx)
+		if gcsClientErr != nil {
+			gcsClientErr = fmt.Errorf("no usable Google Cloud credentials (run gcloud auth application-default login or set GOOGLE_APPLICATION_CREDENTIALS): %s", gcsClientErr)
+		}
+	})
+	return gcsClient, gcsClientErr
+}
+
+func fetchGCSObject(resource string) ([]byte, map[string]interface{}, error) {
+	bucket, key, err := splitBucketKey(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := gocontext.Background()
+	client, err := loadGCSClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	object := client.Bucket(bucket).Object(key)
+	attrs, err := object.Attrs(ctx)
+	if err != nil {
+		return nil, nil, describeGCSError(err, bucket, key)
+	}
+	// read the generation we have the etag for, in case it's replaced
+	reader, err := object.Generation(attrs.Generation).NewReader(ctx)
+	if err != nil {
+		return nil, nil, describeGCSError(err, bucket, key)
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, map[string]interface{}{
+		"bucket": bucket,
+		"key":    key,
+		"etag":   attrs.Etag,
+	}, nil
+}
+
+func describeGCSError(err error, bucket string, key string) error {
+	var apiErr *googleapi.Error
+	switch {
+	case errors.Is(err, storage.ErrObjectNotExist):
+		return fmt.Errorf("no object %q in bucket %q", key, bucket)
+	case errors.Is(err, storage.ErrBucketNotExist):
+		return fmt.Errorf("no bucket %q", bucket)
+	case errors.As(err, &apiErr) && (apiErr.Code == http.StatusUnauthorized || apiErr.Code == http.StatusForbidden):
+		return fmt.Errorf("access denied (check the permissions of the Google Cloud credentials in use): %s", apiErr.Message)
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// gitContent is information about the git repository containing the
+// working directory (-git-context), found by running git.
+type gitContent struct {
+	// optional makes it null outside a repository, rather than an error
+	optional bool
+}
+
+func (gc *gitContent) load() (interface{}, error) {
+	if _, err := runGit("rev-parse", "--git-dir"); err != nil {
+		if gc.optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("-git-context: %s", err)
+	}
+	result, err := readGitInfo()
+	if err != nil {
+		return nil, fmt.Errorf("-git-context: %s", err)
+	}
+	return result, nil
+}
+
+func readGitInfo() (map[string]interface{}, error) {
+	log, err := runGit("log", "-1", "--format=%H%n%h%n%cI")
+	if err != nil {
+		return nil, err
+	}
+	commit := strings.Split(log, "\n")
+	if len(commit) != 3 {
+		return nil, fmt.Errorf("unexpected output from git log: %q", log)
+	}
+	status, err := runGit("status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return nil, err
+	}
+	// these fail when HEAD is detached or has no tag, which just leaves
+	// them empty
+	branch, _ := runGit("symbolic-ref", "--short", "-q", "HEAD")
+	tag, _ := runGit("describe", "--tags", "--exact-match", "HEAD")
+
+	return map[string]interface{}{
+		"commit":      commit[0],
+		"shortCommit": commit[1],
+		"commitTime":  commit[2],
+		"branch":      branch,
+		"tag":         tag,
+		"dirty":       status != "",
+	}, nil
+}
+
+func (gc *gitContent) metadata() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+// runGit runs git in the working directory, returning its trimmed output.
+func runGit(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.Command("git", args...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), message)
+		}
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitContextFlag is -git-context, which can be given alone (for the key
+// git) or as -git-context=key, with ,optional to allow running outside a
+// repository.
+type gitContextFlag struct {
+	key      string
+	optional bool
+}
+
+// IsBoolFlag lets -git-context be given without a value.
+func (g *gitContextFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (g *gitContextFlag) String() string {
+	if g.optional {
+		return g.key + ",optional"
+	}
+	return g.key
+}
+
+func (g *gitContextFlag) Set(value string) error {
+	*g = gitContextFlag{key: "git"}
+	switch value {
+	case "true":
+		return nil
+	case "false":
+		g.key = ""
+		return nil
+	}
+
+	// the key is checked by run, since flag would describe a bad value
+	// here as an invalid boolean
+	for _, part := range strings.Split(value, ",") {
+		if part == "optional" {
+			g.optional = true
+		} else {
+			g.key = part
+		}
+	}
+	return nil
+}
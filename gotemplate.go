@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	// Quick hack of ghodss YAML to expose a new method
+	yaml_ghodss "github.com/wryun/yaml-1"
+)
+
+// goTemplateFuncs are available in -go-template templates, in addition to
+// the text/template builtins.
+var goTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"yaml": func(v interface{}) (string, error) {
+		data, err := yaml_ghodss.Marshal(v)
+		return strings.TrimSuffix(string(data), "\n"), err
+	},
+}
+
+// loadGoTemplate loads the -go-template file, which formats each rendered
+// document as text. Missing keys are an error rather than <no value>.
+func loadGoTemplate(filename string) (*template.Template, error) {
+	return template.New(filepath.Base(filename)).
+		Option("missingkey=error").
+		Funcs(goTemplateFuncs).
+		ParseFiles(filename)
+}
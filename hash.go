@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+)
+
+// hashBuiltin returns a function (added by -enable-hash) that hashes a
+// value's canonical JSON (i.e. compact, with object keys sorted), so the
+// same value always gives the same hash.
+func hashBuiltin(newHash func() hash.Hash) func(interface{}) (string, error) {
+	return func(value interface{}) (string, error) {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err != nil {
+			return "", err
+		}
+
+		h := newHash()
+		h.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+}
+
+// hashBuiltins are the functions added by -enable-hash.
+var hashBuiltins = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
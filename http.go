@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// httpClient fetches http:// and https:// contexts and templates.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func init() {
+	for _, scheme := range []string{"http", "https"} {
+		scheme := scheme
+		uriSources[scheme] = uriSource{
+			description: "fetched with a GET request (see -http-timeout)",
+			fetch: func(resource string) ([]byte, map[string]interface{}, error) {
+				data, err := fetchURL(scheme + "://" + resource)
+				return data, nil, err
+			},
+		}
+	}
+}
+
+// Settings for fetching http(s) URLs, from the -http-* flags.
+var (
+	// httpHeaders are added to every request
+	httpHeaders = make(http.Header)
+	// httpRetries is how many times to retry after a connection error or
+	// a 5xx response
+	httpRetries int
+	// httpRetryDelay is the delay before the first retry, which doubles
+	// for each one after it
+	httpRetryDelay = 500 * time.Millisecond
+	// httpCacheDir, if set, is where responses with an ETag are cached
+	httpCacheDir string
+)
+
+// maxHTTPRetryDelay caps the exponential backoff between retries.
+const maxHTTPRetryDelay = 30 * time.Second
+
+func fetchURL(url string) ([]byte, error) {
+	cached, err := readHTTPCache(url)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := httpRetryDelay
+	for attempt := 1; ; attempt++ {
+		data, retryable, err := fetchURLOnce(url, cached)
+		if err == nil {
+			return data, nil
+		}
+		if !retryable || attempt > httpRetries {
+			if attempt > 1 {
+				return nil, fmt.Errorf("%s (after %d attempts)", err, attempt)
+			}
+			return nil, err
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > maxHTTPRetryDelay {
+			delay = maxHTTPRetryDelay
+		}
+	}
+}
+
+// fetchURLOnce makes a single GET request, reporting whether a failure
+// is worth retrying.
+func fetchURLOnce(url string, cached *httpCacheEntry) ([]byte, bool, error) {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	for name, values := range httpHeaders {
+		request.Header[name] = values
+	}
+	if cached != nil {
+		request.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, true, err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotModified && cached != nil:
+		return cached.Body, false, nil
+	case response.StatusCode >= 500:
+		return nil, true, fmt.Errorf("GET returned %s", response.Status)
+	case response.StatusCode < 200 || response.StatusCode > 299:
+		return nil, false, fmt.Errorf("GET returned %s", response.Status)
+	}
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	if etag := response.Header.Get("ETag"); etag != "" {
+		if err := writeHTTPCache(url, &httpCacheEntry{URL: url, ETag: etag, Body: data}); err != nil {
+			return nil, false, err
+		}
+	}
+	return data, false, nil
+}
+
+// httpCacheEntry is a response cached in -http-cache.
+type httpCacheEntry struct {
+	URL  string `json:"url"`
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+}
+
+func httpCacheFile(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return filepath.Join(httpCacheDir, hex.EncodeToString(hash[:])+".json")
+}
+
+// readHTTPCache returns the cached response for url, if there is one.
+func readHTTPCache(url string) (*httpCacheEntry, error) {
+	if httpCacheDir == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(httpCacheFile(url))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entry httpCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != url {
+		// a corrupt entry (or, in theory, a hash collision) is just a miss
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func writeHTTPCache(url string, entry *httpCacheEntry) error {
+	if httpCacheDir == "" {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(httpCacheDir, 0777); err != nil {
+		return err
+	}
+	// written to a temporary file and renamed, so concurrent renders
+	// never see part of an entry
+	tmp, err := ioutil.TempFile(httpCacheDir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), httpCacheFile(url))
+}
+
+// parseHTTPHeader parses a -http-header value ("Name: value").
+func parseHTTPHeader(header string) (string, string, error) {
+	parts := strings.SplitN(header, ":", 2)
+	name := strings.TrimSpace(parts[0])
+	if len(parts) != 2 || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("-http-header %q should be 'Name: value'", header)
+	}
+	return name, strings.TrimSpace(parts[1]), nil
+}
+
+// maxHTTPResponseBytes limits the size of a response body read by the
+// http builtin (-http-max-bytes).
+var maxHTTPResponseBytes int64 = 10 << 20
+
+// httpBuiltin is the http(method, url, headers, body) function added to
+// the context by -enable-http. A string body is sent as is, and anything
+// else (except null) as JSON.
+func httpBuiltin(method string, url string, headers map[string]interface{}, body interface{}) (map[string]interface{}, error) {
+	var bodyReader io.Reader
+	isJSON := false
+	switch typedBody := body.(type) {
+	case nil:
+	case string:
+		bodyReader = strings.NewReader(typedBody)
+	default:
+		encoded, err := json.Marshal(typedBody)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(encoded)
+		isJSON = true
+	}
+
+	request, err := http.NewRequest(method, url, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	if isJSON {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		value, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("http header %s must be a string, not %s", k, describeType(v))
+		}
+		request.Header.Set(k, value)
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	// read one more byte than allowed so we can tell if it's too big
+	responseBody, err := ioutil.ReadAll(io.LimitReader(response.Body, maxHTTPResponseBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(responseBody)) > maxHTTPResponseBytes {
+		return nil, fmt.Errorf("%s %s: response is larger than %d bytes (see -http-max-bytes)", method, url, maxHTTPResponseBytes)
+	}
+
+	responseHeaders := make(map[string]interface{}, len(response.Header))
+	for k, values := range response.Header {
+		responseHeaders[k] = strings.Join(values, ", ")
+	}
+	return map[string]interface{}{
+		"status":  float64(response.StatusCode),
+		"body":    string(responseBody),
+		"headers": responseHeaders,
+	}, nil
+}
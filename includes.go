@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// includeKey marks an object to be replaced by another template file.
+const includeKey = "$rjsone-include"
+
+// resolveIncludes replaces each {$rjsone-include: path} object in template
+// with the template in path (which must have a single document), resolved
+// relative to dir. Any other keys in the object are merged over the
+// included object. including is the chain of files being included, to
+// catch cycles.
+func resolveIncludes(template interface{}, dir string, opts *loadOptions, including []string) (interface{}, error) {
+	switch typedTemplate := template.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(typedTemplate))
+		for k, v := range typedTemplate {
+			if k == includeKey {
+				continue
+			}
+			resolved, err := resolveIncludes(v, dir, opts, including)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = resolved
+		}
+
+		path, ok := typedTemplate[includeKey]
+		if !ok {
+			return result, nil
+		}
+		filename, ok := path.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s should be a filename, not %s", includeKey, describeType(path))
+		}
+		included, err := includeTemplate(filename, dir, opts, including)
+		if err != nil {
+			return nil, err
+		}
+		if len(result) == 0 {
+			return included, nil
+		}
+
+		includedMap, ok := included.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("including %s: can only merge other keys into an object, not %s", filename, describeType(included))
+		}
+		merged := make(map[string]interface{}, len(includedMap)+len(result))
+		for k, v := range includedMap {
+			merged[k] = v
+		}
+		for k, v := range result {
+			merged[k] = v
+		}
+		return merged, nil
+	case []interface{}:
+		result := make([]interface{}, len(typedTemplate))
+		for i, v := range typedTemplate {
+			resolved, err := resolveIncludes(v, dir, opts, including)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = resolved
+		}
+		return result, nil
+	default:
+		return template, nil
+	}
+}
+
+// includeTemplate loads an included template, resolving its own includes
+// relative to its directory.
+func includeTemplate(filename string, dir string, opts *loadOptions, including []string) (interface{}, error) {
+	if !filepath.IsAbs(filename) && dir != "" {
+		filename = filepath.Join(dir, filename)
+	}
+	confined, err := opts.confine(filename)
+	if err != nil {
+		return nil, fmt.Errorf("including %s: %s", filename, err)
+	}
+	abs, err := filepath.Abs(confined)
+	if err != nil {
+		return nil, err
+	}
+	for _, previous := range including {
+		if previous == abs {
+			return nil, fmt.Errorf("including %s: include cycle", filename)
+		}
+	}
+
+	template, err := loadTemplateFile(confined, opts)
+	if err == nil {
+		template, err = resolveIncludes(template, filepath.Dir(filename), opts, appendPath(including, abs))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("including %s: %s", filename, err)
+	}
+	return template, nil
+}
+
+// resolveTemplateIncludes resolves the includes in a template given as for
+// -t, which are relative to its directory if it's a file.
+func resolveTemplateIncludes(template interface{}, templateFile string, opts *loadOptions) (interface{}, error) {
+	if !isTemplateFile(templateFile) {
+		return resolveIncludes(template, "", opts, nil)
+	}
+	abs, err := filepath.Abs(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	return resolveIncludes(template, filepath.Dir(templateFile), opts, []string{abs})
+}
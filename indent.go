@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseIndents reads the -indent format=width settings into the string
+// each output format indents with. jsonIndentation is -i, which -indent
+// json=... replaces.
+func parseIndents(specs []string, jsonIndentation int, jsonIndentationSet bool) (map[string]string, error) {
+	indents := map[string]string{"json": strings.Repeat(" ", jsonIndentation)}
+	for _, spec := range specs {
+		splitSpec := strings.SplitN(spec, "=", 2)
+		if len(splitSpec) != 2 {
+			return nil, fmt.Errorf("-indent %q should be format=width (e.g. yaml=4 or json=tab)", spec)
+		}
+		format, width := splitSpec[0], splitSpec[1]
+
+		switch format {
+		case "json", "yaml":
+		case "csv":
+			return nil, fmt.Errorf("-indent %s: csv output isn't indented", spec)
+		default:
+			return nil, fmt.Errorf("-indent %s: unknown output format %q (use json or yaml)", spec, format)
+		}
+		if format == "json" && jsonIndentationSet {
+			return nil, fmt.Errorf("-indent %s: use either -i or -indent json=... (not both)", spec)
+		}
+
+		if width == "tab" {
+			if format == "yaml" {
+				return nil, fmt.Errorf("-indent %s: YAML can't be indented with tabs", spec)
+			}
+			indents[format] = "\t"
+			continue
+		}
+		n, err := strconv.Atoi(width)
+		if err != nil || n < 0 || (format == "yaml" && n < 2) {
+			return nil, fmt.Errorf("-indent %s: width should be a number of spaces (at least 2 for YAML, or 0 for compact JSON) or tab", spec)
+		}
+		indents[format] = strings.Repeat(" ", n)
+	}
+	return indents, nil
+}
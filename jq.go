@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+
+	"github.com/itchyny/gojq"
+)
+
+func init() {
+	builtins["jq"] = jqBuiltin
+}
+
+// dottedPathRegexp matches the -query dotted paths (e.g. metadata.name,
+// with \. for a dot in a key) that are used as paths rather than jq
+// filters.
+var dottedPathRegexp = regexp.MustCompile(`^([\w/-]|\\.)+(\.([\w/-]|\\.)+)*$`)
+
+// compileJQ parses and compiles the jq filter (see gojq).
+func compileJQ(filter string) (*gojq.Code, error) {
+	query, err := gojq.Parse(filter)
+	if err != nil {
+		return nil, err
+	}
+	return gojq.Compile(query)
+}
+
+// runJQ returns every value that code outputs for value.
+func runJQ(code *gojq.Code, value interface{}) ([]interface{}, error) {
+	var results []interface{}
+	iter := code.Run(value)
+	for {
+		result, ok := iter.Next()
+		if !ok {
+			return results, nil
+		}
+		if err, ok := result.(error); ok {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+}
+
+// jqFilters caches the filters compiled by jqBuiltin, which is usually
+// called with the same one for each item of a list.
+var jqFilters = make(map[string]*gojq.Code)
+
+// jqBuiltin returns the value the jq filter outputs for value. A filter
+// that outputs more (or fewer) values is an error, so they have to be
+// collected with [...].
+func jqBuiltin(filter string, value interface{}) (interface{}, error) {
+	code, ok := jqFilters[filter]
+	if !ok {
+		var err error
+		code, err = compileJQ(filter)
+		if err != nil {
+			return nil, fmt.Errorf("jq: %s: %s", filter, err)
+		}
+		jqFilters[filter] = code
+	}
+
+	results, err := runJQ(code, value)
+	if err != nil {
+		return nil, fmt.Errorf("jq: %s: %s", filter, err)
+	}
+	if len(results) != 1 {
+		return nil, fmt.Errorf("jq: %s output %d values, not 1 (use [%s] for a list of them)", filter, len(results), filter)
+	}
+	return fromJQ(results[0]), nil
+}
+
+// fromJQ converts the integers gojq may output to the float64s json-e
+// uses for every number.
+func fromJQ(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromJQ(item)
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = fromJQ(item)
+		}
+	}
+	return value
+}
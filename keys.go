@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// keyTransform modifies the keys of a loaded context before it is merged.
+type keyTransform struct {
+	renames   [][2]string
+	pick      []string
+	drop      []string
+	keyCase   string
+	recursive bool
+	prefix    string
+}
+
+var keyCases = map[string]func(string) string{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"snake": toSnakeCase,
+	"camel": toCamelCase,
+}
+
+// parseKeyOptions parses key[option,...] into the key and its
+// transformation (nil if there are no options).
+func parseKeyOptions(key string) (string, *keyTransform, error) {
+	if !strings.HasSuffix(key, "]") {
+		return key, nil, nil
+	}
+	start := strings.Index(key, "[")
+	if start == -1 {
+		return key, nil, nil
+	}
+
+	kt := &keyTransform{}
+	for _, option := range strings.Split(key[start+1:len(key)-1], ",") {
+		splitOption := strings.SplitN(option, "=", 2)
+		name := splitOption[0]
+		if name == "recursive" && len(splitOption) == 1 {
+			kt.recursive = true
+			continue
+		}
+		if len(splitOption) != 2 {
+			return "", nil, fmt.Errorf("key option %q should be name=value", option)
+		}
+		value := splitOption[1]
+
+		switch name {
+		case "pick":
+			kt.pick = append(kt.pick, value)
+		case "drop":
+			kt.drop = append(kt.drop, value)
+		case "case":
+			if _, ok := keyCases[value]; !ok {
+				return "", nil, fmt.Errorf("unknown key case %q (use lower, upper, snake or camel)", value)
+			}
+			kt.keyCase = value
+		case "prefix":
+			kt.prefix = value
+		default:
+			return "", nil, fmt.Errorf("unknown key option %q", name)
+		}
+	}
+
+	return key[:start], kt, nil
+}
+
+// renamesRegexp matches the @old=new suffixes, which can't start with an
+// escaped \@.
+var renamesRegexp = regexp.MustCompile(`(?:^|[^\\])((?:@[^@=:/]+=[^@=:/]+)+)$`)
+
+// splitRenames removes any @old=new suffixes from the content part of a
+// context argument, adding them to kt (which is created if nil), and
+// unescapes any \@ in the rest (e.g. config\@v=2.yaml). Raw text and
+// functions can't be renamed.
+func splitRenames(rawContent string, kt *keyTransform) (string, *keyTransform) {
+	if _, data := parseFormat(rawContent); strings.HasPrefix(data, "+") || strings.HasPrefix(data, "-") && data != "-" {
+		return rawContent, kt
+	}
+
+	content := rawContent
+	if match := renamesRegexp.FindStringSubmatchIndex(rawContent); match != nil {
+		suffix := rawContent[match[2]:]
+		content = rawContent[:match[2]]
+		if kt == nil {
+			kt = &keyTransform{}
+		}
+		for _, rename := range strings.Split(suffix[1:], "@") {
+			splitRename := strings.SplitN(rename, "=", 2)
+			kt.renames = append(kt.renames, [2]string{splitRename[0], splitRename[1]})
+		}
+	}
+	return strings.Replace(content, `\@`, "@", -1), kt
+}
+
+func (kt *keyTransform) apply(v interface{}) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot transform keys of %s", describeType(v))
+	}
+
+	if len(kt.renames) > 0 {
+		renamed := make(map[string]interface{}, len(m))
+		for k, value := range m {
+			renamed[k] = value
+		}
+		for _, rename := range kt.renames {
+			value, ok := renamed[rename[0]]
+			if !ok {
+				return nil, fmt.Errorf("no key %q to rename", rename[0])
+			}
+			if _, ok := renamed[rename[1]]; ok {
+				return nil, fmt.Errorf("cannot rename %q to %q, which already exists", rename[0], rename[1])
+			}
+			delete(renamed, rename[0])
+			renamed[rename[1]] = value
+		}
+		m = renamed
+	}
+
+	if len(kt.pick) > 0 {
+		picked := make(map[string]interface{}, len(kt.pick))
+		for _, k := range kt.pick {
+			if value, ok := m[k]; ok {
+				picked[k] = value
+			}
+		}
+		m = picked
+	}
+
+	if len(kt.drop) > 0 {
+		kept := make(map[string]interface{}, len(m))
+		for k, value := range m {
+			kept[k] = value
+		}
+		for _, k := range kt.drop {
+			delete(kept, k)
+		}
+		m = kept
+	}
+
+	if kt.keyCase != "" {
+		var err error
+		m, err = convertKeys(m, keyCases[kt.keyCase], kt.recursive)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if kt.prefix != "" {
+		prefixed := make(map[string]interface{}, len(m))
+		for k, value := range m {
+			prefixed[kt.prefix+k] = value
+		}
+		m = prefixed
+	}
+
+	return m, nil
+}
+
+func convertKeys(m map[string]interface{}, convert func(string) string, recursive bool) (map[string]interface{}, error) {
+	// sorted so that collision errors are deterministic
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string]interface{}, len(m))
+	originals := make(map[string]string, len(m))
+	for _, k := range keys {
+		newKey := convert(k)
+		if original, ok := originals[newKey]; ok {
+			return nil, fmt.Errorf("keys %q and %q both become %q", original, k, newKey)
+		}
+		originals[newKey] = k
+
+		value := m[k]
+		if recursive {
+			var err error
+			value, err = convertNestedKeys(value, convert)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", k, err)
+			}
+		}
+		result[newKey] = value
+	}
+	return result, nil
+}
+
+func convertNestedKeys(v interface{}, convert func(string) string) (interface{}, error) {
+	switch typedV := v.(type) {
+	case map[string]interface{}:
+		return convertKeys(typedV, convert, true)
+	case []interface{}:
+		result := make([]interface{}, len(typedV))
+		for i, child := range typedV {
+			var err error
+			result[i], err = convertNestedKeys(child, convert)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %s", i, err)
+			}
+		}
+		return result, nil
+	default:
+		return v, nil
+	}
+}
+
+// splitWords splits an identifier into words on any non-alphanumeric
+// characters and on case changes, keeping runs of upper case letters
+// together (so HTTPServer is HTTP Server).
+func splitWords(s string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(s)
+
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := word[len(word)-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(prev) || nextIsLower {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+
+	return words
+}
+
+func toSnakeCase(s string) string {
+	words := splitWords(s)
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+	return strings.Join(words, "_")
+}
+
+func toCamelCase(s string) string {
+	words := splitWords(s)
+	for i, word := range words {
+		runes := []rune(strings.ToLower(word))
+		if i > 0 {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		words[i] = string(runes)
+	}
+	return strings.Join(words, "")
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// kvSeparatorEscapes are the escapes allowed when specifying separators,
+// since these characters are awkward to put in an argument.
+var kvSeparatorEscapes = map[string]string{
+	`\n`: "\n",
+	`\t`: "\t",
+	`\0`: "\x00",
+	`\s`: " ",
+	`\\`: `\`,
+}
+
+// isKVFormat reports whether format is kv, possibly with separators.
+func isKVFormat(format inputFormat) bool {
+	return strings.HasPrefix(string(format), string(kvFormat))
+}
+
+// parseKVSeparators parses the record and field separators from a
+// kv format such as kv;= (records separated by ;, fields by =).
+func parseKVSeparators(format inputFormat) (string /* record */, string /* field */, error) {
+	spec := strings.TrimPrefix(string(format), string(kvFormat))
+
+	var separators []string
+	for len(spec) > 0 {
+		if strings.HasPrefix(spec, `\`) && len(spec) >= 2 {
+			separator, ok := kvSeparatorEscapes[spec[:2]]
+			if !ok {
+				return "", "", fmt.Errorf("format %q has unknown escape %s", format, spec[:2])
+			}
+			separators = append(separators, separator)
+			spec = spec[2:]
+			continue
+		}
+		r := []rune(spec)[0]
+		separators = append(separators, string(r))
+		spec = spec[len(string(r)):]
+	}
+
+	if len(separators) != 2 {
+		return "", "", fmt.Errorf("format %q should be kv followed by a record separator and a field separator", format)
+	}
+	return separators[0], separators[1], nil
+}
+
+// kvEscapes makes \ an escape character in kv keys and values
+// (-kv-escapes).
+var kvEscapes = false
+
+// kvEscapeSequences are the escapes understood with -kv-escapes. The
+// flag's help is generated from these, so it matches the parser.
+var kvEscapeSequences = []struct {
+	escape      string
+	value       string
+	description string
+}{
+	{`\ `, " ", "a space that doesn't end the key"},
+	{`\n`, "\n", "newline"},
+	{`\t`, "\t", "tab"},
+	{`\\`, `\`, "backslash"},
+}
+
+// describeKVEscapes lists the kv escapes for -kv-escapes' help.
+func describeKVEscapes() string {
+	descriptions := make([]string, len(kvEscapeSequences))
+	for i, e := range kvEscapeSequences {
+		descriptions[i] = fmt.Sprintf("%s (%s)", e.escape, e.description)
+	}
+	return strings.Join(descriptions, ", ") + `, and \ before a separator for the separator itself`
+}
+
+// parseKV parses records of key/value pairs, splitting each record on
+// the first field separator. A field separator of a space matches any
+// Unicode space (e.g. a tab or non-breaking space). Empty records are
+// ignored.
+func parseKV(data []byte, recordSep string, fieldSep string) (interface{}, error) {
+	result := make(map[string]interface{})
+	s := string(data)
+	for len(s) > 0 {
+		key, value, rest, err := nextKVRecord(s, recordSep, fieldSep)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			result[*key] = value
+		}
+		s = rest
+	}
+	return result, nil
+}
+
+// nextKVRecord reads the record at the start of s, returning the rest of
+// s after it. The key is nil if the record is empty.
+func nextKVRecord(s string, recordSep string, fieldSep string) (*string, string /* value */, string /* rest */, error) {
+	var fields [2]strings.Builder
+	field := 0
+
+	i := 0
+	for i < len(s) && !strings.HasPrefix(s[i:], recordSep) {
+		if kvEscapes && s[i] == '\\' {
+			escaped, size, err := kvEscape(s[i:], recordSep, fieldSep)
+			if err != nil {
+				return nil, "", "", fmt.Errorf("record %q: %s", s[:endOfRecord(s, recordSep)], err)
+			}
+			fields[field].WriteString(escaped)
+			i += size
+			continue
+		}
+		if size := kvFieldSepSize(s[i:], fieldSep); field == 0 && size > 0 {
+			field = 1
+			i += size
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		fields[field].WriteRune(r)
+		i += size
+	}
+
+	rest := strings.TrimPrefix(s[i:], recordSep)
+	if i == 0 {
+		return nil, "", rest, nil
+	}
+	if field == 0 {
+		return nil, "", "", fmt.Errorf("record not in kv format: %q", s[:i])
+	}
+	key := fields[0].String()
+	return &key, fields[1].String(), rest, nil
+}
+
+// kvFieldSepSize returns the length of the field separator at the start
+// of s, or 0 if there isn't one.
+func kvFieldSepSize(s string, fieldSep string) int {
+	if fieldSep == " " {
+		r, size := utf8.DecodeRuneInString(s)
+		if unicode.IsSpace(r) {
+			return size
+		}
+		return 0
+	}
+	if strings.HasPrefix(s, fieldSep) {
+		return len(fieldSep)
+	}
+	return 0
+}
+
+// kvEscape decodes the escape at the start of s, returning what it stands
+// for and its length.
+func kvEscape(s string, recordSep string, fieldSep string) (string, int, error) {
+	for _, e := range kvEscapeSequences {
+		if strings.HasPrefix(s, e.escape) {
+			return e.value, len(e.escape), nil
+		}
+	}
+	if strings.HasPrefix(s[1:], recordSep) {
+		return recordSep, 1 + len(recordSep), nil
+	}
+	if size := kvFieldSepSize(s[1:], fieldSep); size > 0 {
+		return s[1 : 1+size], 1 + size, nil
+	}
+	if len(s) == 1 {
+		return "", 0, errors.New("ends with an unfinished escape")
+	}
+	r, _ := utf8.DecodeRuneInString(s[1:])
+	return "", 0, fmt.Errorf("unknown escape \\%c (see -kv-escapes)", r)
+}
+
+// endOfRecord returns the length of the record at the start of s.
+func endOfRecord(s string, recordSep string) int {
+	if end := strings.Index(s, recordSep); end != -1 {
+		return end
+	}
+	return len(s)
+}
+
+// loadKVAllowlist reads the -kv-allowlist file: one key per line, in the
+// same format as @file arguments (so blank lines and # comments are
+// ignored).
+func loadKVAllowlist(filename string) (map[string]bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys, err := readArgs(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	allowlist := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		allowlist[key] = true
+	}
+	return allowlist, nil
+}
+
+// checkKVKeys fails if kv has any keys that aren't in allowlist, naming
+// them (and the allowed key each is closest to, as they're probably
+// typos).
+func checkKVKeys(kv map[string]interface{}, allowlist map[string]bool) error {
+	var unknown []string
+	for _, key := range sortedKeys(kv) {
+		if allowlist[key] {
+			continue
+		}
+		if similar := closestKey(key, allowlist); similar != "" {
+			key = fmt.Sprintf("%s (did you mean %s?)", key, similar)
+		}
+		unknown = append(unknown, key)
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("keys not in the -kv-allowlist: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// closestKey returns the allowed key nearest to key, if any is close.
+func closestKey(key string, allowlist map[string]bool) string {
+	allowed := make([]string, 0, len(allowlist))
+	for k := range allowlist {
+		allowed = append(allowed, k)
+	}
+	sort.Strings(allowed)
+
+	closest, closestDistance := "", len(key)/4+2
+	for _, k := range allowed {
+		distance := editDistance(key, k)
+		if strings.EqualFold(key, k) {
+			distance = 0
+		}
+		if distance < closestDistance {
+			closest, closestDistance = k, distance
+		}
+	}
+	return closest
+}
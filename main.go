@@ -1,19 +1,25 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"compress/gzip"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/imdario/mergo"
-	jsone "github.com/taskcluster/json-e"
 	// Quick hack of ghodss YAML to expose a new method
 	yaml_ghodss "github.com/wryun/yaml-1"
-	yaml_v2 "gopkg.in/yaml.v2"
+
+	"github.com/wryun/rjsone/ext"
 )
 
 const description = `rjsone is a simple wrapper around the JSON-e templating language.
@@ -29,7 +35,53 @@ reading the file. For example:
     rjsone -t template.yaml context.yaml '+{"foo": 1}'
 
 When duplicate keys are found, later entries replace earlier at the
-top level only unless the -d flag is passed to perform deep merging.
+top level only unless the -d flag is passed to perform deep merging
+(with -v, a warning is shown when a key is replaced). Alternatively,
+-collect-duplicates turns a key given more than once into a list of
+the values in argument order, so extra:a.yaml extra:b.yaml sets
+extra to a list of the contents of a.yaml and b.yaml.
+A key given once is left as it is, so that other keys aren't changed; a
+template that accepts either can check typeof(extra) == "array".
+
+To deep merge just one key, add a + to the end of it. For example, this
+merges the labels in more-labels.yaml with the labels from base.yaml,
+while the keys in overlay.yaml replace earlier ones as usual:
+
+    rjsone -t template.yaml base.yaml labels+:more-labels.yaml overlay.yaml
+
+An empty context file (or one that's only whitespace, --- or null)
+adds no keys, which is handy for optional overlay files; with a key, its
+value is null. Any other file without a key must be an object, since its
+top level keys are what's merged.
+
+Templates and contexts must be UTF-8. A byte order mark at the start (as
+some Windows tools add) is ignored, and anything else that isn't UTF-8 is
+an error giving the file and the offset of the first bad byte.
+
+To concatenate a bunch of list fragments instead,
+-merge-lists-at-top-level items appends each list context without a key
+to items (a list context given a key is unaffected):
+
+    rjsone -merge-lists-at-top-level items -t template.yaml fragments/*.yaml
+
+When rjsone is part of a larger system, -context-prefix inputs puts
+everything loaded under inputs (so a template uses ${inputs.name}),
+keeping it apart from functions such as those added by -enable-http.
+
+To prune dead config, -warn-unused-context lists the top level context
+keys that the template never references (as -v does) once it's
+rendered, and -strict-unused makes them an error. Only the keys' names
+are looked for, so a key counts as used if anything in an expression
+has its name.
+
+For one-off renders, -prompt asks on the terminal for each top-level
+key the template uses that wasn't given, reading the answer as YAML,
+and then renders that document again. It only asks when stderr is a
+terminal and stdin isn't used for the template or a context. Otherwise
+(or when the answer is empty) -prompt-default key=value supplies the
+value, so scripts can rely on the same defaults:
+
+    rjsone -prompt -prompt-default replicas=1 -t template.yaml
 
 You can specify a particular context key to load a YAML/JSON file into
 using keyname:filename.yaml. You can also use keyname:.. to indicate
@@ -38,13 +90,110 @@ into that key. If you instead use keyname:..., metadata information is
 loaded as well and each list element is an object containing {filename,
 basename, content}.
 
+A list ends at the next argument with a key, or at an argument that is
+just : (which lets you follow a list with arguments that don't have
+keys). For example, this loads two files into mylist and merges
+the third into the context:
+
+    mylist:.. a.yaml b.yaml : c.yaml
+
+Using the same list key again adds to the existing list, so lists can
+be interleaved. For example, this sets cluster.apps to the contents
+of a1.yaml and a2.yaml and cluster.deps to the contents of d1.yaml:
+
+    cluster.apps:.. a1.yaml cluster.deps:.. d1.yaml cluster.apps:.. a2.yaml
+
+As that shows, keys containing dots are nested. Only the final key is
+set, so sibling keys are kept, which means you can override a single
+deep value without writing out the objects around it:
+
+    rjsone -t template.yaml base.yaml db.host::+localhost
+
+Use \. for a dot that is part of a key (e.g. 'a\.b::+x').
+
 When loading the context, the default input format is YAML but you can
-also use JSON, plain text, and kv (key value pairs, space separated,
-as used by bazel and many unix tools). To specify the format, rather
-than using a : you use :format:. For example:
+also use JSON, plain text, kv (key value pairs, space separated,
+as used by bazel and many unix tools), and prototext (protobuf text
+format; since there is no descriptor, a field only becomes a list if
+it is repeated). To specify the format, rather than using a : you
+use :format:. For example:
 
     :yaml:ctx.yaml :kv:ctx.kv :json:ctx.json mykey:text:ctx.txt
 
+For static-site-style templating, the frontmatter format reads a text
+file (e.g. Markdown) with YAML front matter between --- lines at the
+start, giving the front matter with the rest of the file as content
+(use [drop=content] on the key if you don't want it):
+
+    post:frontmatter:article.md
+
+The ndjson format reads JSON Lines (one JSON value per line, with blank
+lines ignored) as a list, and a malformed line is an error giving its
+line number:
+
+    events:ndjson:events.jsonl
+
+-list-formats prints every supported input and output format.
+
+Templates and YAML contexts are read as YAML 1.2, so NO, on and
+yes are strings, 0644 is the number 644 (write 0o644 for
+octal), and duplicate keys are an error. Pass -yaml-1.1 to get the
+YAML 1.1 behaviour of older versions of rjsone, where they're booleans
+and octal.
+
+JSON only has string keys, so other scalar keys are used as they're
+written: 80: http has the key "80" and true: x has "true" (with
+-yaml-1.1, keys are converted like values, so 0x1F is "31"). A null
+or list key is an error giving the JSON pointer of its mapping.
+Aliases that would expand to more than a million nodes are an error
+too.
+
+Custom tags (e.g. !Ref) are ignored by default, leaving the value as if
+it wasn't tagged. -yaml-tags handles sets of them instead (see
+-list-formats): with include, !include file is replaced by that file,
+read as readFile(file, "") would (and confined to -root), and with
+cloudformation, CloudFormation's short form intrinsic functions become
+their JSON form, so !GetAtt Bucket.Arn is {"Fn::GetAtt": ["Bucket", "Arn"]}
+and the stack can be read as a context:
+
+    rjsone -yaml-tags include,cloudformation -t template.yaml stack:stack.yaml
+
+To catch typos in kv (and .env) contexts, -kv-allowlist file lists
+the keys they may have, one per line (blank lines and # comments are
+ignored). Any other key is an error naming it, along with the allowed
+key it's closest to.
+
+To reshape a context before it's merged (e.g. third party data that
+doesn't fit your templates), follow it with | and a json-e template,
+which is rendered with the loaded value as value (and the builtins),
+and whose result is used instead. Several can be chained, and they run
+before any renames:
+
+    rjsone -t template.yaml 'services:raw.yaml|byname.yaml'
+
+where byname.yaml might be:
+
+    $merge:
+      $map: {$eval: value.Services}
+      each(s): {'${s.Name}': {$eval: s.Port}}
+
+Like context files, transform templates must be inside -root. Use \|
+if a filename has a | in it.
+
+With -auto-format, files (and URIs) without a format get one from their
+extension if it's known (e.g. .json is read as JSON, .txt as text and
+.env as KEY=VALUE lines), and otherwise are still read as YAML. An
+explicit format, including one given to a list, always wins:
+
+    rjsone -auto-format -t template.yaml notes:notes.txt app.env
+
+For scripts, certificates and the like, which would otherwise be parsed
+(or fail to parse) as YAML, -text-extensions lists extensions whose files
+are read as text when they don't have a format, with or without
+-auto-format (and by readData). That saves writing :: before each one:
+
+    rjsone -text-extensions .sh,.pem -t template.yaml scripts:.. *.sh ca:ca.pem
+
 Note that you must specify a key name under which to load the plain text
 file, since it cannot define keys (i.e. is a plain text string). Also,
 although the default format is yaml, the default format with :: is
@@ -58,6 +207,177 @@ the template:
 
     rjsone -t template.yaml env::+production context.yaml
 
+For programs that have already assembled the context, -context-json
+takes it as a JSON object (or @file, with @- for stdin), which is merged
+into the context before the positional contexts, so they can still
+override parts of it:
+
+    rjsone -context-json "$(generate-context)" -t template.yaml image.tag::+v2
+
+-git-context adds information about the git repository containing the
+working directory as git (or another key, with -git-context=key):
+commit, shortCommit, branch and tag (empty if HEAD is detached or
+untagged), dirty (whether tracked files have changed) and commitTime.
+Outside a repository this is an error, unless you add ,optional (e.g.
+-git-context=git,optional), which makes it null instead:
+
+    rjsone -git-context -t template.yaml context.yaml
+
+Similarly, -inject-env-facts adds facts about where rjsone is running
+as rjsone (or -inject-env-facts=key): host, cwd, pid, ppid,
+uid, gid, user (empty if it can't be looked up), os and arch
+(as Go names them, e.g. linux and amd64). Like -git-context, it
+comes before the other contexts, so they can override it. Under rjsone,
+the facts sit alongside each document's documentIndex and documentCount:
+
+    rjsone -inject-env-facts -t +'built on ${rjsone.host}'
+
+The kv format can be followed by a record separator and a field separator
+(by default a newline and a space), where \n, \t, \0, \s (space) and
+\\ can be used for characters that are awkward to type. For example,
+:kv;=:ctx.txt reads a=1;b=2, and :kv\0=:/proc/self/environ reads
+the environment of the current process.
+
+Each record is split on the first field separator, and a space
+separator (the default) matches any Unicode space, such as a tab or a
+non-breaking space. To put a separator in a key or value, -kv-escapes
+makes \ an escape character in kv contexts: \  is a space that
+doesn't end the key, \n a newline, \t a tab, \\ a backslash, and \
+before a separator is the separator itself (see the flag's help, which
+is generated from the parser's table).
+
+To use only part of a file (or stdin), add # followed by a JSON
+pointer (RFC 6901) to the part you want. Use \# if the filename
+itself contains a #. For example:
+
+    image:ctx.yaml#/spec/template/image
+
+To pass several inputs from a pipeline without temporary files, fd:N
+reads the open file descriptor N (in the given format, like a file).
+In a ... list, its metadata is {fd}. For example:
+
+    rjsone -t template.yaml data:json:fd:3 extra:fd:4 3<a.json 4<b.yaml
+
+Files inside a tar or zip archive (.tar, .tar.gz, .tgz or .zip) are
+given as archive!member, for contexts and for the template (-t). Each
+archive is only read once, however many of its members are used. Use
+\! if a filename contains a !. In a list, the member can be a pattern
+that adds every matching member, as a shell glob would for files, and
+the metadata also has the archive. For example:
+
+    cfg:yaml:bundle.tar.gz!configs/prod.yaml
+    manifests:... 'bundle.zip!manifests/*.yaml'
+
+Instead of a filename, a context can come from a scheme://resource URI
+for the sources built into rjsone (-list-formats shows them). http://
+and https:// URLs are always available (with a timeout set by -http-
+timeout), and the template (-t) can be a URL too. To avoid their
+dependencies in the default build, cloud sources need a build tag: for
+example, building with -tags aws adds aws-sm://, which reads a secret
+from AWS Secrets Manager using the usual AWS credentials:
+
+    rjsone -t template.yaml secrets:json:aws-sm://prod/db
+
+When fetching http(s) URLs, -http-header 'Name: value' (which may be
+repeated) adds a header to every request, and -http-bearer-token-env
+VAR sends the token in the environment variable VAR as Authorization:
+Bearer ..., which keeps it out of your shell history. Both are sent to
+every URL, so only use them with hosts you trust. -http-retries N
+retries connection errors and 5xx responses up to N times, with
+exponential backoff. With -http-cache dir, responses with an ETag are
+cached in dir and revalidated with If-None-Match, so an unchanged
+document isn't downloaded again:
+
+    rjsone -http-bearer-token-env CONFIG_TOKEN -http-retries 3 -http-cache .cache \
+        -t template.yaml cfg:json:https://config.example.com/prod.json
+
+Objects in S3 (s3://bucket/key, with -tags aws) and Google Cloud
+Storage (gs://bucket/key, with -tags gcp) can be read in the same way,
+using the SDKs' default credentials. Their metadata (see ...) includes
+the bucket, key and etag. For example:
+
+    rjsone -t template.yaml cfg:json:s3://configs/prod/env.json
+
+Secret stores are given as a format, followed by the path in the store.
+The vault format reads the data of a HashiCorp Vault KV secret (v1 or
+v2) using VAULT_ADDR, VAULT_TOKEN and (if set) VAULT_NAMESPACE. For KV
+v2, the path can include the data/ after the mount or not, as with vault
+kv get. For example:
+
+    rjsone -t template.yaml db:vault:secret/data/prod/db
+
+With -tags aws, the ssm format reads a parameter from AWS SSM Parameter
+Store, or every parameter under a path ending in / as an object nested
+by / (relative to the path). SecureStrings are decrypted, and
+StringLists become lists. For example, with parameters
+/myapp/prod/db/url and /myapp/prod/name:
+
+    rjsone -t template.yaml params:ssm:/myapp/prod/
+
+sets params to {db: {url: ...}, name: ...}.
+
+The template can also be given directly after a +, as for contexts:
+
+    rjsone -t '+{"greeting": {"$eval": "name"}}' name::+world
+
+To split a template across files, an object {$rjsone-include: path} is
+replaced by the template in path (relative to the including file)
+before rendering, so it's rendered against the same context. Any other
+keys in the object are merged over the included object, and included
+files can include others (but not themselves). For example:
+
+    containers:
+      - $rjsone-include: lib/container.yaml
+        image: sidecar:1
+
+The jsonpatch and mergepatch formats are special: rather than being
+merged into the context, they are applied to the context accumulated so
+far (i.e. from the arguments to their left) as an RFC 6902 JSON Patch
+or an RFC 7386 JSON Merge Patch respectively. If a key is given, only
+the value under that key is patched. For example:
+
+    rjsone -t template.yaml context.yaml :jsonpatch:fix.yaml
+
+The keys of a loaded context can be transformed before it is merged
+by adding options in square brackets to the key part of an argument
+(the key itself is optional). The options are applied in this order:
+
+    pick=k       only keep the top level key k (may be repeated)
+    drop=k       remove the top level key k (may be repeated)
+    case=c       convert keys to lower, upper, snake or camel case
+    recursive    apply case to nested keys as well as top level keys
+    prefix=p     add p to the start of each top level key
+
+For example, to load environment-style keys as aws_access_key_id etc.:
+
+    [case=lower,prefix=aws_,pick=ACCESS_KEY_ID]:kv:aws.env
+
+It's an error if a case conversion makes two keys the same.
+
+Top level keys can also be renamed (before any other options are
+applied) by adding @old=new to the end of a file or stdin argument,
+as many times as needed. For example:
+
+    :yaml:third-party.yaml@hostName=host@portNumber=port
+
+Use \@ for an @ in a filename that's followed by = (e.g.
+config\@v=2.yaml).
+
+If there are too many context arguments, or they are generated by
+another program, an argument of the form @args.txt is replaced by the
+arguments in args.txt, one per line. Blank lines and lines starting
+with # are ignored, and leading and trailing whitespace is removed,
+but no other quoting is needed (spaces are part of the argument). If
+you need leading or trailing whitespace, or a leading #, put the line
+in double quotes (Go string escapes are supported). Argument files can
+contain other @ arguments, but only one level deep.
+
+The special argument @- reads arguments from stdin in the same way.
+Since stdin can only be read once, the template must be provided with
+-t, and no context can use - (stdin):
+
+    find overlays -name '*.yaml' | rjsone -t template.yaml base.yaml @-
+
 For complex applications, single argument functions can be added by
 prefixing the filename with a - (or a -- for raw string input). For
 example:
@@ -71,6 +391,364 @@ like b64decode([], 'Zm9vCg=='). As with before, you can use format
 specifiers (:- is yaml on both sides for the default behaviour, and
 you can explicitly specify kv/json/text/yaml between both :: and
 --).
+
+Function output is read leniently as YAML, so a command that logs to
+stdout can produce a garbled value rather than an error. With
+-strict-functions, output must be valid in the format given for the
+function (e.g. f:json:-cmd), and YAML output that is just several lines
+of text is rejected.
+
+Inline commands are split on spaces and run directly, without a
+shell. With -exec-shell, they are run with sh -c (or cmd /C on
+Windows) instead, so they can use pipes, builtins and quoted paths
+containing spaces; the function's arguments are still passed safely
+(appended as "$@", or quoted for cmd on Windows):
+
+    rjsone -exec-shell -t template.yaml shout::--'cat | tr a-z A-Z'
+
+To avoid splitting altogether, an inline command can be a JSON list of
+strings: the command and its arguments, which are passed exactly as
+given (with or without -exec-shell). For example:
+
+    fn:json:--'["mycmd", "--flag", "a b"]'
+
+To avoid overloading the machine (or a rate limited service), use
+-exec-parallelism N to limit how many function commands can run at
+once.
+
+Function commands inherit rjsone's environment. To keep secrets in it
+away from them, -function-env-allowlist PATH,HOME passes only the
+variables listed (plus any env from a -functions manifest). An empty
+list passes none.
+
+Command line arguments that aren't strings (numbers, booleans, lists
+or objects) are JSON encoded, so f([3, {a: 1}], '') runs the command
+with the arguments 3 and {"a":1}. Pass -strict-function-args to
+make non-string arguments an error instead.
+
+Rather than writing the command inline, you can put it in an
+executable script and refer to it with @ after the prefix:
+
+    lookup:-@scripts/lookup.sh
+
+The script is run directly (its path isn't split on spaces), is
+resolved against the template's directory with -relative-to-template,
+and must exist and be executable when the contexts are loaded. In a
+... list, the metadata for a script function is {script}.
+
+When there are many functions, they can instead be defined in a YAML
+file passed with -functions, mapping each function name to its command
+(a list, so no splitting on spaces) and options:
+
+    lookup:
+      command: [scripts/lookup.sh, --region, eu-west-1]
+      rawInput: false   # as for a - prefix; true is like --
+      rawOutput: false
+      env: {LOOKUP_CACHE: /tmp/lookup}
+      timeout: 10s
+
+A function declared positionally with the same key replaces the
+manifest's definition.
+
+If a function is called many times, starting a process for every call
+can be slow. Adding & after the prefix (or coprocess: true in a
+-functions manifest) starts the command once, on the first call, and
+sends it each call as a line of JSON on stdin:
+
+    {"args": [...], "stdin": ...}
+
+It must reply to each with a line of JSON on stdout, either
+{"result": ...} or {"error": "..."}. The command's stdin is closed at
+the end of the run, and it must then exit successfully. For example:
+
+    lookup:-&@scripts/lookup-server.sh
+
+Functions can also be written in Go and loaded as a plugin with
+-plugin (on platforms that support Go plugins). The plugin must export:
+
+    func Register(register func(name string, fn interface{}) error) error
+
+which calls register for each function (fn must be a function that
+json-e can call, e.g. func(string) string). Go code can also import
+github.com/wryun/rjsone/ext and call ext.RegisterFunction directly,
+or ext.SetFS to have files, templates and includes read from an
+fs.FS (such as an embed.FS). A context key with the same name as a
+registered function replaces it, with a warning.
+
+If you use a --- prefix instead, the function always returns an object
+{stdout, exitCode, durationMs} (with stdout as a string) rather than
+failing when the command exits with a non-zero status. For example:
+
+    check::---'grep -q production'
+
+To output only part of each rendered document, pass -query a JSON
+pointer or a dotted path (where list indexes are numbers, and \. is a
+dot in a key). It's an error if the path doesn't exist. For example,
+these both output just the name:
+
+    rjsone -query /metadata/name -t template.yaml
+    rjsone -query metadata.name -t template.yaml
+
+Anything else is a jq filter (see https://github.com/itchyny/gojq), which
+is checked before anything is rendered. Each value it outputs is output
+as a document, so this outputs the name of every item:
+
+    rjsone -query '.items[].metadata.name' -t template.yaml
+
+A filter that's a single word (like keys) would be taken as a path, so
+write it as . | keys.
+
+Like jq -r, -r outputs documents that are strings as raw text (each
+followed by a newline) rather than as JSON strings:
+
+    rjsone -r -query metadata.name -t template.yaml
+
+To produce text output, -go-template names a Go text/template file
+that's executed with each rendered document as . (after -query),
+instead of encoding it as JSON or YAML. Missing keys are an error, and
+json and yaml functions encode a value. For example:
+
+    {{range .services}}{{.name}}:{{.port}}
+    {{end}}
+
+So later steps know exactly what a run produced, -manifest path writes
+a JSON list of the files written (with -o) after rendering. With
+-manifest-hashes, each is {path, sha256} instead of just its path.
+
+By default, a document that fails to render stops the whole run. When
+the documents are independent (e.g. many generated manifests), use
+-on-render-error skip to output the rest anyway; a warning gives the
+number skipped, and -v shows each error.
+
+To indent each output format differently, -indent format=width (which
+may be repeated) sets the number of spaces, or tab for JSON. For example,
+-indent json=tab -indent yaml=4. -indent json=... replaces -i.
+
+Output is only written once every document has rendered, so a failure
+part way through doesn't leave partial output for e.g. kubectl apply -f -
+to act on. The exception is stdout when it's a terminal, where each
+document is written as it's rendered; -stream does that anywhere (e.g.
+for large outputs), and -buffer never does.
+
+With -append, the output file (-o) is added to rather than replaced,
+so a stream of documents can be built up over several runs (for YAML,
+a --- separator is added when the file isn't empty). It can't be used
+with -diff.
+
+To keep the output file and also pipe it onward, -tee writes the output
+to stdout too (just what this run rendered, so without the separator
+added by -append or any compression).
+
+When the output file ends in .gz (or with -compress, which also works
+for stdout), the output is gzipped. -append adds another gzip member,
+which gunzip reads as one stream, and -diff compares against the
+uncompressed file.
+
+To look up data while rendering, -enable-http adds a function
+
+    http(method, url, headers, body)
+
+which returns {status, body, headers} (with body as a string). A string
+body is sent as is, and any other non-null body is sent as JSON. Requests
+time out after -http-timeout, and responses larger than -http-max-bytes
+are an error.
+
+Some functions are always added to the context, unless -no-builtins is
+given (a context key or plugin of the same name replaces one).
+semverCompare(constraint, version) returns whether a semantic version
+matches a constraint in the style of Masterminds/semver, where comparisons
+separated by commas or spaces must all match, || separates
+alternatives, and x (or leaving off the end) matches any number (e.g.
+>=1.21.x, <2, ^1.2, ~1.2.3 or 1.0 - 1.4). A prerelease version
+only matches a constraint that mentions a prerelease.
+semverParse(version) returns an object with major, minor, patch,
+prerelease and metadata:
+
+    $if: semverCompare(">=1.21.x", kubernetes.version)
+    then: {apiVersion: policy/v1}
+    else: {apiVersion: policy/v1beta1}
+
+For defaults and overrides within a template, merge(a, b, ...) merges
+objects as contexts are by default (each one's top level keys replace
+those before it), and deepMerge(a, b, ...) merges them as -d does, using
+the same code: objects are merged recursively, while lists (and any other
+values) replace what was there, except that null leaves it as it is. A
+null argument is treated as an empty object. jsonPatch(value, ops)
+applies an RFC 6902 JSON Patch, as a jsonpatch context would:
+
+    spec: {$eval: "deepMerge(defaults, environments[env])"}
+
+For names and keys, toSnakeCase(s), toKebabCase(s) and toCamelCase(s)
+split s into words at anything other than letters and digits and where
+lower case changes to upper case. A run of capitals is one word, except
+for a last capital that starts the next word, so HTTPServer,
+http-server and HTTP_SERVER are all http_server in snake case.
+title(s) capitalises the first letter of each space separated word,
+and trimPrefix(s, prefix) and trimSuffix(s, suffix) remove prefix or
+suffix if s has it:
+
+    name: ${toKebabCase(trimSuffix(component, "Controller"))}
+
+For durations and sizes in configuration, parseDuration(s) parses a Go
+duration such as 2h30m or 300ms as seconds, and formatDuration(seconds)
+formats seconds that way. parseSize(s) parses a size such as 512Mi,
+1.5GB or 100 as bytes, with SI (k, M, G, T, P, E) and IEC (Ki,
+Mi, Gi, Ti, Pi, Ei) units, optionally followed by B.
+formatSize(bytes, style) formats bytes with the largest si or iec unit
+that fits, to two decimal places (e.g. 1.5Gi):
+
+    timeoutSeconds: {$eval: parseDuration(timeout)}
+    heap: ${formatSize(parseSize(memory) * 0.75, "iec")}
+
+The builtins that read files honour -root and -relative-to-template as
+context files do, and can be left out with -no-fs-builtins:
+fileExists(path) is whether a file exists, glob(pattern) is the sorted
+list of paths matching a pattern such as config/*.yaml, and
+readFile(path, format) parses a file as format, or by its extension if
+format is "" (as for readData):
+
+    extra:
+      $if: fileExists("overrides.yaml")
+      then: {$eval: 'readFile("overrides.yaml", "")'}
+
+For building endpoints, urlParse(url) returns an object with scheme,
+host (without brackets around an IPv6 address), port, path, query and
+fragment, where path and query are left encoded.
+urlJoin(base, ref) resolves a relative reference as a browser would (so
+../v2 and /health replace parts of the base's path), and
+urlEncode(s) and urlDecode(s) escape and unescape a component such as a
+query parameter:
+
+    url: ${urlJoin(api.base, "users?name=" + urlEncode(user.name))}
+
+For network layouts, there are Terraform-style functions that work with
+IPv4 and IPv6: cidrHost(cidr, n) is the nth address in the range (a
+negative n counts back from the end), cidrSubnet(cidr, newbits, index)
+is the indexth subnet with newbits more bits of prefix,
+cidrContains(cidr, ip) is whether the range contains an address, and
+ipAdd(ip, n) adds to an address. A number past the end of the range (or
+the address space) is an error rather than wrapping around:
+
+    gateway: ${cidrHost(cidrSubnet(vpc.cidr, 8, 2), 1)}
+
+jq(filter, value) returns the value a jq filter outputs for value
+(so a filter that outputs several has to collect them with [...]):
+
+    ports: {$eval: 'jq("[.services[].port] | unique", config)'}
+
+So templates can check their own inputs, -enable-schema adds a function
+validateSchema(schema, value), which returns value if it matches the
+JSON Schema (draft-07) and otherwise fails, listing every violation with
+its JSON pointer. The schema is an ordinary value, usually loaded as a
+context. Only local $refs (e.g. #/definitions/port) are supported,
+and format isn't checked:
+
+    config: {$eval: "validateSchema(schemas.config, rawConfig)"}
+
+For a stable hash of part of the context (e.g. to name a ConfigMap that
+changes whenever its content does), -enable-hash adds the functions
+sha256(value) and md5(value). They return the hex hash of the value as
+canonical JSON (compact, with object keys sorted), so a string is hashed
+with its quotes:
+
+    name: config-${sha256(config)[:8]}
+
+To pull in data based on computed paths, -base-dir dir adds a function
+
+    readData(path, format)
+
+which reads path (relative to dir, and refusing anything outside it
+after resolving symlinks) and parses it as format, as a context would be.
+If format is "", it's inferred from the extension (see -auto-format),
+falling back to YAML:
+
+    config: {$eval: 'readData(env + "/config.yaml", "")'}
+
+For two-phase templating, -chain renders a second template against the
+context plus the first template's result (under -chain-key, which is
+rendered by default), and only outputs the second. If the first template
+doesn't have exactly one document, the result is a list of its documents.
+For example:
+
+    rjsone -t compute.yaml -chain format.yaml -chain-key computed context.yaml
+
+Each document in a multi-document template is rendered with rjsone
+in the context, an object with its documentIndex (from 0) and the
+documentCount, so documents can be numbered or differ (unless
+the context already has an rjsone key, which is left as it is):
+
+    name: part-${rjsone.documentIndex + 1}-of-${rjsone.documentCount}
+
+Memory use grows with the template and the output: every document in the
+template is read before any is rendered (so documentCount is known), and
+unless output is streamed (see -stream) every rendered document is kept
+until the last one is done. For a huge template that's a list of
+independent items, -split-items renders each item as its own document.
+A .json template is then read an item at a time, so with -stream only
+the item being rendered is in memory (and documentCount isn't set, since it
+isn't known yet); any other template (which may be YAML, even if it
+starts with [) still has to be read in full, but each item is dropped
+once it's rendered:
+
+    rjsone -split-items -stream -t huge.json context.yaml > out.jsonl
+
+An empty template (or one with only whitespace and comments) has no
+documents, so by default rjsone outputs nothing and succeeds. In a
+pipeline where that means an earlier step failed, -require-template
+makes it an error instead (an explicitly empty document, ---, still
+counts, and renders as null):
+
+    generate-template | rjsone -require-template -t - context.yaml
+
+Before relying on a template's output being the same every time (e.g. to
+cache what it renders by hash), -assert-deterministic renders it twice,
+loading the context again in between so that functions are run again, and
+fails if the encoded output differs, saying which document differs first
+and showing a diff. Contexts read from stdin or a file descriptor can't be
+loaded twice, so can't be used with it:
+
+    rjsone -assert-deterministic -y -t deployment.yaml build:-./build-info.sh
+
+To check how rjsone understood a command line, -explain prints each
+context argument followed by how it was parsed (its kind, key, format,
+file or command and so on, with the members of lists indented beneath
+them) and exits, without loading any context or rendering the template:
+
+    $ rjsone -explain name::+world mylist:.. a.yaml :json:b.json
+    name::+world  kind=text key=name format=text text=world
+    mylist:..     kind=list key=mylist format=yaml metadata=false
+      a.yaml        kind=file format=yaml file=a.yaml
+      :json:b.json  kind=file format=json file=b.json
+
+For scripts (or when the text form is ambiguous), -explain=json and
+-explain=yaml print the same information as a list of objects, each with
+the argument, its fields and, for a list, its items:
+
+    $ rjsone -explain=yaml foo::+bar:baz
+    - argument: foo::+bar:baz
+      format: text
+      key: foo
+      kind: text
+      text: bar:baz
+
+To debug a template, -trace shows each document's template (as JSON,
+after YAML's type conversions), the context keys it can see and its
+result on stderr. Values longer than -trace-limit bytes are truncated.
+When rendering fails, -pretty-errors shows the failing document on
+stderr with the lines of the part json-e complained about (e.g. the
+$eval or the interpolated string) marked with >>.
+
+As a guard against runaway data (e.g. from a function), contexts and
+rendered documents can be nested at most -max-depth levels deep (200
+by default), and -max-output-bytes limits the total size of the
+output. Both errors name where the limit was hit.
+
+Output is reproducible: object keys are always sorted when encoding
+(for JSON, YAML and CSV), and rjsone's own errors and warnings are
+reported in a stable order. The one exception is json-e's $map over an
+object, which calls each() for the entries in no particular order, so
+functions with side effects called from it may run in any order
+(although the result is the same).
 `
 
 type arguments struct {
@@ -80,9 +758,89 @@ type arguments struct {
 	verbose      bool
 	deepMerge    bool
 	outputFile   string
-	contexts     []context
+	rawContexts  []string
+
+	yamlLeadingSeparator bool
+	banner               string
+	bannerFile           string
+	diff                 bool
+	maxDepth             int
+	maxOutputBytes       int64
+	strictUnused         bool
+	strictKeys           bool
+	expandEnv            bool
+	expandEnvStrict      bool
+	relativeToTemplate   bool
+	root                 string
+	buffer               bool
+	version              bool
+	listFormats          bool
+	collectDuplicates    bool
+	outputTemplate       string
+	query                string
+	goTemplate           string
+	outputFormat         string
+	strictFunctionArgs   bool
+	autoFormat           bool
+	gitContext           gitContextFlag
+	envFacts             envFactsFlag
+	functions            string
+	plugins              stringsFlag
+	functionEnvAllowlist namesFlag
+	strictFunctions      bool
+	execShell            bool
+	execParallelism      int
+	appendOutput         bool
+	httpTimeout          time.Duration
+	enableHTTP           bool
+	httpMaxBytes         int64
+	httpHeaders          stringsFlag
+	httpBearerTokenEnv   string
+	httpRetries          int
+	httpCache            string
+	trace                bool
+	traceLimit           int
+	prompt               bool
+	promptDefaults       stringsFlag
+	prettyErrors         bool
+	chain                string
+	chainKey             string
+	manifest             string
+	kvAllowlist          string
+	mergeListsKey        string
+	compress             bool
+	contextPrefix        string
+	stream               bool
+	tee                  bool
+	readDataDir          string
+	warnUnused           bool
+	enableHash           bool
+	rawOutput            bool
+	splitItems           bool
+	textExtensions       string
+	contextJSON          string
+	explain              explainFlag
+	requireTemplate      bool
+	assertDeterministic  bool
+	yamlTags             string
+	enableSchema         bool
+	onRenderError        string
+	noBuiltins           bool
+	noFSBuiltins         bool
+	indentSpecs          stringsFlag
+	manifestHashes       bool
+
+	// indentationSet is whether -i was given (rather than defaulted)
+	indentationSet bool
+	// indents are the indentation for each output format, from -i and
+	// -indent
+	indents map[string]string
 }
 
+// errOutputDiffers is returned by run in -diff mode when the rendered
+// output doesn't match the output file.
+var errOutputDiffers = errors.New("rendered output differs from output file")
+
 type content interface {
 	load() (interface{}, error)
 	metadata() map[string]interface{}
@@ -96,23 +854,211 @@ func main() {
 		flag.PrintDefaults()
 		fmt.Fprint(flag.CommandLine.Output(), "\n")
 	}
-	flag.StringVar(&args.templateFile, "t", "-", "file to use for template (- is stdin)")
+	flag.StringVar(&args.templateFile, "t", "-", "file to use for template (- is stdin, +text is the template itself, or an http(s) URL)")
+	flag.DurationVar(&args.httpTimeout, "http-timeout", 30*time.Second, "timeout for fetching http(s) URLs (and for the http function)")
+	flag.Var(&args.httpHeaders, "http-header", "header ('Name: value') sent when fetching http(s) URLs (may be repeated)")
+	flag.StringVar(&args.httpBearerTokenEnv, "http-bearer-token-env", "", "environment variable holding a token sent as Authorization: Bearer when fetching http(s) URLs")
+	flag.IntVar(&args.httpRetries, "http-retries", 0, "times to retry fetching an http(s) URL after a connection error or 5xx response, with exponential backoff")
+	flag.StringVar(&args.httpCache, "http-cache", "", "directory to cache http(s) responses with an ETag in, revalidating them with If-None-Match")
+	flag.StringVar(&args.readDataDir, "base-dir", "", "add a readData(path, format) function to the context, which reads and parses files in this directory")
+	flag.BoolVar(&args.noFSBuiltins, "no-fs-builtins", false, "don't add the builtin functions that read files (fileExists, glob and readFile) to the context")
+	flag.BoolVar(&args.noBuiltins, "no-builtins", false, "don't add rjsone's builtin functions (e.g. semverCompare) to the context")
+	flag.BoolVar(&args.enableSchema, "enable-schema", false, "add a validateSchema(schema, value) function to the context, which returns value if it matches the JSON Schema (draft-07) and fails otherwise")
+	flag.BoolVar(&args.enableHash, "enable-hash", false, "add sha256(value) and md5(value) functions to the context, which hash the value's canonical JSON")
+	flag.BoolVar(&args.enableHTTP, "enable-http", false, "add an http(method, url, headers, body) function to the context, returning {status, body, headers}")
+	flag.Int64Var(&args.httpMaxBytes, "http-max-bytes", 10<<20, "maximum size of a response body read by the http function")
 	flag.BoolVar(&args.yaml, "y", false, "output YAML rather than JSON (always reads YAML/JSON)")
+	flag.StringVar(&args.chain, "chain", "", "second template, rendered (instead of outputting the first) with the first template's result in the context as -chain-key")
+	flag.StringVar(&args.chainKey, "chain-key", "rendered", "context key for the first template's result with -chain")
 	flag.BoolVar(&args.verbose, "v", false, "show information about processing on stderr")
+	flag.BoolVar(&args.trace, "trace", false, "show each document's template, the context keys it can see and its result on stderr")
+	flag.IntVar(&args.traceLimit, "trace-limit", 2000, "maximum bytes of each value shown by -trace; 0 means unlimited")
+	flag.BoolVar(&args.prettyErrors, "pretty-errors", false, "when rendering fails, show the template on stderr with the part that failed marked")
 	flag.BoolVar(&args.deepMerge, "d", false, "performs a deep merge of contexts")
 	flag.StringVar(&args.outputFile, "o", "-", "output to a file (default is -, which is stdout)")
+	flag.BoolVar(&args.appendOutput, "append", false, "append to the output file (-o) rather than replacing it")
 	flag.IntVar(&args.indentation, "i", 2, "indentation of JSON output; 0 means no pretty-printing")
+	flag.Var(&args.indentSpecs, "indent", "format=width indentation for an output format, e.g. yaml=4 or json=tab (may be repeated)")
+	flag.BoolVar(&args.yamlLeadingSeparator, "yaml-leading-separator", false, "emit --- before the first YAML document")
+	flag.StringVar(&args.banner, "banner", "", "text to write as a comment block at the top of YAML output (ignored for JSON)")
+	flag.StringVar(&args.bannerFile, "banner-file", "", "file containing the banner text (see -banner)")
+	flag.BoolVar(&args.tee, "tee", false, "write the output to stdout as well as the output file (-o)")
+	flag.BoolVar(&args.compress, "compress", false, "gzip the output (the default if the output file (-o) ends in .gz)")
+	flag.BoolVar(&args.diff, "diff", false, "print a unified diff against the output file (-o) rather than writing it; exits 1 if they differ")
+	flag.IntVar(&args.maxDepth, "max-depth", 200, "maximum nesting depth of a context or rendered document; 0 means unlimited")
+	flag.Int64Var(&args.maxOutputBytes, "max-output-bytes", 0, "maximum size of the rendered output; 0 means unlimited")
+	flag.BoolVar(&args.strictUnused, "strict-unused", false, "fail if any top level context key is never referenced by the template (-warn-unused-context and -v only warn)")
+	flag.BoolVar(&args.warnUnused, "warn-unused-context", false, "warn about top level context keys the template never references")
+	flag.StringVar(&args.textExtensions, "text-extensions", "", "comma separated extensions (e.g. .sh,.pem) of files to read as text when they don't have a format, even without -auto-format")
+	flag.BoolVar(&args.autoFormat, "auto-format", false, "infer the format of contexts without one from their extension (e.g. .json, .txt, .env; see -list-formats)")
+	flag.Var(&args.envFacts, "inject-env-facts", "add the host, cwd, pid, ppid, uid, gid, user, os and arch rjsone is running with to the context as rjsone (or -inject-env-facts=key)")
+	flag.Var(&args.gitContext, "git-context", "add the working directory's git commit, shortCommit, branch, tag, dirty and commitTime to the context as git (or -git-context=key); add ,optional to allow running outside a repository")
+	flag.BoolVar(&args.prompt, "prompt", false, "ask on the terminal for context keys the template uses that weren't given (when stderr is a terminal and stdin isn't otherwise used)")
+	flag.Var(&args.promptDefaults, "prompt-default", "key=value (YAML) to use for a missing context key when it can't be asked for, or the default when it is (may be repeated)")
+	flag.StringVar(&args.kvAllowlist, "kv-allowlist", "", "file listing the keys kv contexts may have (one per line); any other key is an error")
+	flag.BoolVar(&kvEscapes, "kv-escapes", false, "treat \\ as an escape in kv keys and values: "+describeKVEscapes())
+	flag.StringVar(&args.yamlTags, "yaml-tags", "", "comma separated sets of custom YAML tags to handle rather than ignore: include (!include file) and cloudformation (!Ref, !Sub and so on)")
+	flag.BoolVar(&yaml11, "yaml-1.1", false, "read templates and YAML contexts with YAML 1.1 rules (yes/no/on/off are booleans, 0644 is octal) rather than YAML 1.2")
+	flag.StringVar(&args.contextJSON, "context-json", "", "a JSON object (or @file, with @- for stdin) merged into the context before the positional contexts, for callers that have already assembled it")
+	flag.StringVar(&args.contextPrefix, "context-prefix", "", "put the whole loaded context under this key (e.g. inputs), so it can't collide with functions")
+	flag.StringVar(&args.mergeListsKey, "merge-lists-at-top-level", "", "concatenate contexts without a key that are lists (rather than objects) into this key, e.g. items")
+	flag.StringVar(&args.functions, "functions", "", "YAML file defining functions ({name: {command, rawInput, rawOutput, env, timeout}}); positional contexts with the same key win")
+	flag.Var(&args.plugins, "plugin", "Go plugin (.so) exporting Register(func(name string, fn interface{}) error) error to add functions (may be repeated)")
+	flag.Var(&args.functionEnvAllowlist, "function-env-allowlist", "comma separated environment variables function commands inherit (rather than all of them); may be repeated, and an empty list passes none")
+	flag.BoolVar(&args.execShell, "exec-shell", false, "run function commands with sh -c (cmd /C on Windows) rather than splitting them on spaces")
+	flag.IntVar(&args.execParallelism, "exec-parallelism", 0, "maximum number of function commands running at once; 0 means unlimited")
+	flag.BoolVar(&args.strictFunctions, "strict-functions", false, "fail if a function's output isn't valid in its declared format (e.g. f:json:-cmd) rather than leniently reading it as YAML")
+	flag.BoolVar(&args.strictFunctionArgs, "strict-function-args", false, "fail if a function is called with a non-string argument rather than JSON encoding it")
+	flag.BoolVar(&args.strictKeys, "strict-keys", false, "fail (rather than warn) if a top level context key isn't a valid identifier")
+	flag.BoolVar(&args.expandEnv, "expand-env", false, "expand ${VAR} (not $VAR; $${VAR} is a literal ${VAR}) in yaml, text and kv contexts from the environment before parsing")
+	flag.BoolVar(&args.expandEnvStrict, "expand-env-strict", false, "like -expand-env, but undefined variables are an error rather than empty")
+	flag.BoolVar(&args.relativeToTemplate, "relative-to-template", false, "resolve relative context and output (-o) filenames against the template's directory")
+	flag.StringVar(&args.root, "root", "", "refuse to read context files outside this directory (after resolving symlinks)")
+	flag.BoolVar(&args.buffer, "buffer", false, "only write to stdout once every document has rendered (the default unless stdout is a terminal, and always the case with -o)")
+	flag.BoolVar(&args.requireTemplate, "require-template", false, "fail if the template has no documents (e.g. is empty, or only whitespace and comments), rather than outputting nothing")
+	flag.BoolVar(&args.assertDeterministic, "assert-deterministic", false, "render the template twice, reloading the context (so functions are run again), and fail with a diff if the output differs")
+	flag.BoolVar(&args.splitItems, "split-items", false, "render each item of a template that's a single list as its own document; a .json template is read an item at a time, so with -stream huge ones don't need to fit in memory")
+	flag.BoolVar(&args.stream, "stream", false, "write each document to stdout as soon as it's rendered, even if stdout isn't a terminal")
+	flag.BoolVar(&args.collectDuplicates, "collect-duplicates", false, "collect the values of keys given more than once (e.g. extra:a.yaml extra:b.yaml) into a list; a key given once isn't put in a list")
+	flag.StringVar(&args.outputTemplate, "output-template", "", "template applied to each rendered document (available as doc, so the context can't have a doc key) to produce the output")
+	flag.StringVar(&args.query, "query", "", "only output this part of each rendered document: a JSON pointer (/metadata/name), dotted path (metadata.name) or jq filter (.items[].name)")
+	flag.StringVar(&args.manifest, "manifest", "", "after writing the output file (-o), write a JSON list of the files written to this file")
+	flag.BoolVar(&args.manifestHashes, "manifest-hashes", false, "list each file in -manifest as {path, sha256} rather than just its path")
+	flag.StringVar(&args.onRenderError, "on-render-error", "abort", "what to do when a document fails to render: abort, or skip it (with a warning, and the error with -v) and output the rest")
+	flag.BoolVar(&args.rawOutput, "r", false, "output documents that are strings as raw text rather than JSON strings (e.g. with -query)")
+	flag.StringVar(&args.goTemplate, "go-template", "", "Go text/template file each rendered document (as .) is executed with to produce the output, rather than encoding it")
+	flag.StringVar(&args.outputFormat, "f", "json", "output format: json, yaml or csv (csv requires a list of flat objects)")
+	flag.BoolVar(&args.version, "version", false, "print version information and exit")
+	flag.Var(&args.explain, "explain", "print how each context argument was parsed (its kind, key, format and so on) and exit, without loading or rendering anything; -explain=json or -explain=yaml prints it as a list of objects")
+	flag.BoolVar(&args.listFormats, "list-formats", false, "print the supported input and output formats and exit")
 	flag.Parse()
 
-	args.contexts = parseContexts(flag.Args())
+	if args.version {
+		if err := printVersion(os.Stdout); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Fatal error: %s\n", err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	if args.listFormats {
+		if err := printFormats(os.Stdout); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Fatal error: %s\n", err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	if args.yaml {
+		args.outputFormat = "yaml"
+	}
+	args.yaml = args.outputFormat == "yaml"
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "i" {
+			args.indentationSet = true
+		}
+	})
+
+	args.rawContexts = flag.Args()
 	logger := log.New(os.Stderr, "", 0)
 
-	if err := run(logger, args); err != nil {
+	if err := run(logger, args); err == errOutputDiffers {
+		os.Exit(1)
+	} else if err != nil {
 		fmt.Fprintf(flag.CommandLine.Output(), "Fatal error: %s\n", err)
 		os.Exit(2)
 	}
 }
 
+// validateArgs rejects flag combinations that would otherwise fail
+// confusingly (or do something surprising) later on.
+func validateArgs(l *log.Logger, args arguments) error {
+	if _, ok := outputFormats[args.outputFormat]; !ok {
+		return fmt.Errorf("unknown output format %q (use %s)", args.outputFormat, strings.Join(sortedOutputFormats(), ", "))
+	}
+	switch args.explain {
+	case "", "text", "json", "yaml":
+	default:
+		return fmt.Errorf("-explain=%s should be text, json or yaml", args.explain)
+	}
+	if args.indentation < 0 {
+		return fmt.Errorf("-i %d: indentation must not be negative (use 0 for compact JSON)", args.indentation)
+	}
+	if args.indentationSet && args.yaml {
+		l.Printf("Warning: -i only affects JSON output, so is ignored with YAML\n")
+	}
+	if args.onRenderError != "abort" && args.onRenderError != "skip" {
+		return fmt.Errorf("-on-render-error %q should be abort or skip", args.onRenderError)
+	}
+	if args.rawOutput && (args.outputFormat != "json" || args.goTemplate != "") {
+		return errors.New("-r only applies to JSON output (not -f, -y or -go-template)")
+	}
+	if args.appendOutput && args.outputFile == "-" {
+		return errors.New("-append requires an output file (-o)")
+	}
+	if args.banner != "" && args.bannerFile != "" {
+		return errors.New("-banner and -banner-file can't be used together")
+	}
+	if args.appendOutput && args.diff {
+		return errors.New("-append can't be used with -diff")
+	}
+	if args.tee && (args.outputFile == "-" || args.diff) {
+		return errors.New("-tee requires an output file (-o) and can't be used with -diff")
+	}
+	if args.manifest != "" && (args.outputFile == "-" || args.diff) {
+		return errors.New("-manifest requires an output file (-o) and can't be used with -diff")
+	}
+	if args.manifest != "" && samePath(args.manifest, args.outputFile) {
+		return fmt.Errorf("-manifest %s is the output file (-o)", args.manifest)
+	}
+	if args.buffer && args.stream {
+		return errors.New("-buffer and -stream can't be used together")
+	}
+	if args.manifestHashes && args.manifest == "" {
+		return errors.New("-manifest-hashes requires -manifest")
+	}
+	if args.assertDeterministic && (args.chain != "" || args.prompt) {
+		return errors.New("-assert-deterministic can't be used with -chain or -prompt")
+	}
+	if args.yamlTags != "" && yaml11 {
+		return errors.New("-yaml-tags can't be used with -yaml-1.1, which doesn't keep the tags")
+	}
+	if args.contextPrefix != "" && !identifierRegexp.MatchString(args.contextPrefix) {
+		return fmt.Errorf("-context-prefix %q should be an identifier, so templates can refer to it", args.contextPrefix)
+	}
+
+	// -diff only reads the output file, so it's fine for it to be the
+	// template (e.g. to check a template renders to itself)
+	if args.outputFile != "-" && !args.diff {
+		outputFile := args.outputFile
+		if args.relativeToTemplate && isTemplateFile(args.templateFile) && !filepath.IsAbs(outputFile) {
+			outputFile = filepath.Join(filepath.Dir(args.templateFile), outputFile)
+		}
+		if isTemplateFile(args.templateFile) && samePath(outputFile, args.templateFile) {
+			return fmt.Errorf("-o %s is the template (-t), which would be overwritten before it's read", args.outputFile)
+		}
+		if args.chain != "" && isTemplateFile(args.chain) && samePath(outputFile, args.chain) {
+			return fmt.Errorf("-o %s is the -chain template, which would be overwritten before it's read", args.outputFile)
+		}
+	}
+
+	return nil
+}
+
+// samePath reports whether a and b are the same file by cleaned absolute
+// path (symlinks aren't resolved, as the output file may not exist yet).
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// compressOutput reports whether the output should be gzipped: with
+// -compress, or when the output file ends in .gz.
+func compressOutput(args arguments) bool {
+	return args.compress || (args.outputFile != "-" && strings.HasSuffix(args.outputFile, ".gz"))
+}
+
 func run(l *log.Logger, args arguments) (finalError error) {
 	closeWithError := func(c io.Closer) {
 		if err := c.Close(); err != nil && finalError == nil {
@@ -120,7 +1066,226 @@ func run(l *log.Logger, args arguments) (finalError error) {
 		}
 	}
 
-	context, err := loadContext(args.contexts, args.deepMerge)
+	if args.prettyErrors {
+		defer func() {
+			if re, ok := finalError.(*renderError); ok {
+				l.Print(re.pretty())
+			}
+		}()
+	}
+
+	if err := validateArgs(l, args); err != nil {
+		return err
+	}
+	indents, err := parseIndents(args.indentSpecs, args.indentation, args.indentationSet)
+	if err != nil {
+		return err
+	}
+	args.indents = indents
+
+	if !args.noBuiltins {
+		if err := registerBuiltins(); err != nil {
+			return err
+		}
+	}
+	for _, filename := range args.plugins {
+		if err := loadPlugin(filename); err != nil {
+			return err
+		}
+	}
+
+	httpClient.Timeout = args.httpTimeout
+	maxHTTPResponseBytes = args.httpMaxBytes
+	for _, header := range args.httpHeaders {
+		name, value, err := parseHTTPHeader(header)
+		if err != nil {
+			return err
+		}
+		httpHeaders.Add(name, value)
+	}
+	if args.httpBearerTokenEnv != "" {
+		if httpHeaders.Get("Authorization") != "" {
+			return errors.New("-http-bearer-token-env can't be used with an Authorization -http-header")
+		}
+		token := os.Getenv(args.httpBearerTokenEnv)
+		if token == "" {
+			return fmt.Errorf("-http-bearer-token-env: %s isn't set", args.httpBearerTokenEnv)
+		}
+		httpHeaders.Set("Authorization", "Bearer "+token)
+	}
+	if args.httpRetries < 0 {
+		return errors.New("-http-retries must not be negative")
+	}
+	httpRetries = args.httpRetries
+	httpCacheDir = args.httpCache
+	if args.enableHTTP {
+		if err := ext.RegisterFunction("http", httpBuiltin); err != nil {
+			return err
+		}
+	}
+	if args.enableSchema {
+		if err := ext.RegisterFunction("validateSchema", validateSchemaBuiltin); err != nil {
+			return err
+		}
+	}
+	if args.enableHash {
+		for name, newHash := range hashBuiltins {
+			if err := ext.RegisterFunction(name, hashBuiltin(newHash)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if args.gitContext.key != "" && !identifierRegexp.MatchString(args.gitContext.key) {
+		return fmt.Errorf("-git-context key %q isn't a valid identifier", args.gitContext.key)
+	}
+	if args.envFacts != "" && !identifierRegexp.MatchString(string(args.envFacts)) {
+		return fmt.Errorf("-inject-env-facts key %q isn't a valid identifier", args.envFacts)
+	}
+	if args.chain != "" && !identifierRegexp.MatchString(args.chainKey) {
+		return fmt.Errorf("-chain-key %q isn't a valid identifier", args.chainKey)
+	}
+	if args.chain == "-" && args.templateFile == "-" {
+		return errors.New("-chain can't read from stdin when the template is also read from stdin")
+	}
+
+	rawContexts, readStdin, err := expandArgs(args.rawContexts, os.Stdin)
+	if err != nil {
+		return err
+	}
+	if readStdin && (args.templateFile == "-" || args.chain == "-") {
+		return fmt.Errorf("cannot read context arguments from stdin (%s) when the template is also read from stdin", stdinArgs)
+	}
+
+	opts := &loadOptions{
+		expandEnv:       args.expandEnv || args.expandEnvStrict,
+		expandEnvStrict: args.expandEnvStrict,
+		root:            args.root,
+		autoFormat:      args.autoFormat,
+
+		strictFunctionArgs: args.strictFunctionArgs,
+		strictFunctions:    args.strictFunctions,
+		execShell:          args.execShell,
+
+		functionEnvAllowlist: args.functionEnvAllowlist,
+
+		fsys: ext.FS(),
+	}
+	if args.textExtensions != "" {
+		opts.textExtensions, err = parseTextExtensions(args.textExtensions)
+		if err != nil {
+			return err
+		}
+	}
+	if args.kvAllowlist != "" {
+		opts.kvAllowlist, err = loadKVAllowlist(args.kvAllowlist)
+		if err != nil {
+			return err
+		}
+	}
+	if args.execParallelism < 0 {
+		return errors.New("-exec-parallelism must not be negative")
+	} else if args.execParallelism > 0 {
+		opts.execSlots = make(chan struct{}, args.execParallelism)
+	}
+	defer func() {
+		if err := opts.stopCoprocesses(); err != nil && finalError == nil {
+			finalError = err
+		}
+	}()
+	if args.relativeToTemplate {
+		if args.templateFile == "-" || !isTemplateFile(args.templateFile) {
+			return errors.New("-relative-to-template requires a template file (-t)")
+		}
+		opts.baseDir = filepath.Dir(args.templateFile)
+		if args.outputFile != "-" {
+			args.outputFile = opts.resolve(args.outputFile)
+		}
+		if args.manifest != "" {
+			args.manifest = opts.resolve(args.manifest)
+		}
+	}
+	if !args.noBuiltins && !args.noFSBuiltins {
+		if err := registerFSBuiltins(opts); err != nil {
+			return err
+		}
+	}
+	if args.yamlTags != "" {
+		if err := registerYAMLTags(args.yamlTags, opts); err != nil {
+			return err
+		}
+	}
+	if args.readDataDir != "" {
+		if err := ext.RegisterFunction("readData", readDataBuiltin(opts.resolve(args.readDataDir), opts)); err != nil {
+			return err
+		}
+	}
+	contexts, err := parseContexts(rawContexts, opts)
+	if err != nil {
+		return err
+	}
+	if args.contextJSON != "" {
+		// first, so that positional contexts can override it
+		contextJSON := context{original: "-context-json", content: newContextJSONContent(args.contextJSON, opts)}
+		contexts = append([]context{contextJSON}, contexts...)
+	}
+	if readStdin && readsStdin(contexts) {
+		return fmt.Errorf("cannot read context arguments from stdin (%s) when a context is also read from stdin", stdinArgs)
+	}
+	if args.assertDeterministic && readsDescriptor(contexts, func(int) bool { return true }) {
+		// the second load would find it already read
+		return errors.New("-assert-deterministic can't reload a context read from stdin or a file descriptor")
+	}
+
+	if args.functions != "" {
+		declared := make(map[string]bool)
+		for _, c := range contexts {
+			if c.key != "" {
+				declared[c.key] = true
+			}
+		}
+		functions, err := loadFunctionManifest(args.functions, declared, opts)
+		if err != nil {
+			return err
+		}
+		contexts = append(functions, contexts...)
+	}
+
+	if args.gitContext.key != "" {
+		// first, so that positional contexts can override it
+		git := context{
+			original: "-git-context",
+			key:      args.gitContext.key,
+			content:  &gitContent{optional: args.gitContext.optional},
+		}
+		contexts = append([]context{git}, contexts...)
+	}
+	if args.envFacts != "" {
+		// also first, so positional contexts can override facts
+		facts := context{
+			original: "-inject-env-facts",
+			key:      string(args.envFacts),
+			content:  &envFactsContent{},
+		}
+		contexts = append([]context{facts}, contexts...)
+	}
+
+	if args.explain != "" {
+		return printExplanation(os.Stdout, contexts, args.explain)
+	}
+
+	loadRenderContext := func(l *log.Logger) (map[string]interface{}, error) {
+		context, err := loadContext(l, contexts, args)
+		if err != nil {
+			return nil, err
+		}
+		if args.contextPrefix != "" {
+			// registered functions are added alongside, not under, the prefix
+			context = map[string]interface{}{args.contextPrefix: context}
+		}
+		return context, nil
+	}
+	context, err := loadRenderContext(l)
 	if err != nil {
 		return err
 	}
@@ -134,111 +1299,408 @@ func run(l *log.Logger, args arguments) (finalError error) {
 		l.Println(string(output))
 	}
 
-	var input io.ReadCloser
-	if args.templateFile == "-" {
-		input = os.Stdin
-	} else {
-		input, err = os.Open(args.templateFile)
+	addRegisteredFunctions(l, context)
+
+	input, err := openTemplate(args.templateFile, opts)
+	if err != nil {
+		return err
+	}
+	defer closeWithError(input)
+
+	r := &renderer{args: args, context: context, templateFile: args.templateFile, opts: opts, l: l}
+	if args.verbose || args.warnUnused || args.strictUnused {
+		r.used = make(map[string]bool)
+	}
+	if args.trace {
+		r.trace = &tracer{l: l, limit: args.traceLimit}
+	}
+	if args.prompt || len(args.promptDefaults) > 0 {
+		stdinUsed := readStdin || args.templateFile == "-" || args.chain == "-" || readsStdin(contexts)
+		r.prompt, err = newPrompter(args.promptDefaults, args.prompt && !stdinUsed && isTerminal(os.Stderr))
 		if err != nil {
 			return err
 		}
-		defer closeWithError(input)
 	}
-
-	var out io.WriteCloser
-	if args.outputFile == "-" {
-		out = os.Stdout
-	} else {
-		out, err = os.Create(args.outputFile)
+	if args.goTemplate != "" {
+		if args.outputFormat != "json" {
+			return errors.New("-go-template replaces the output format, so can't be used with -f or -y")
+		}
+		r.goTemplate, err = loadGoTemplate(args.goTemplate)
 		if err != nil {
 			return err
 		}
-		defer closeWithError(out)
 	}
-
-	var encoder *yaml_v2.Encoder
-	if args.yaml {
-		encoder = yaml_v2.NewEncoder(out)
-		defer closeWithError(encoder)
-	}
-
-	decoder := yaml_v2.NewDecoder(input)
-	for {
-		// json-e wants types as output by json, so we have to reach
-		// into the annoying ghodss/yaml code to do the type conversion.
-		// We can't use it directly (trivially), because it doesn't have
-		// multi-document support.
-		var passthroughTemplate interface{}
-		err := decoder.Decode(&passthroughTemplate)
-		if err == io.EOF {
-			return nil
+	if args.query != "" {
+		r.query, r.jq, err = parseQuery(args.query)
+		if err != nil {
+			return err
 		}
+	}
+	if args.outputTemplate != "" {
+		r.outputTemplate, err = loadTemplateFile(args.outputTemplate, opts)
 		if err != nil {
 			return err
 		}
-		var template interface{}
-		err = yaml_ghodss.YAMLTypesToJSONTypes(passthroughTemplate, &template)
+		r.outputTemplate, err = resolveTemplateIncludes(r.outputTemplate, args.outputTemplate, opts)
 		if err != nil {
 			return err
 		}
+		if r.used != nil {
+			collectIdentifiers(r.outputTemplate, r.used)
+		}
+	}
 
-		output, err := jsone.Render(template, context)
+	if args.chain != "" {
+		if _, ok := context[args.chainKey]; ok {
+			return fmt.Errorf("-chain-key %q is already in the context", args.chainKey)
+		}
+		// the first template is rendered as is; only the chained
+		// template's output is written (via -output-template, if any)
+		first := &renderer{args: args, context: context, used: r.used, trace: r.trace, templateFile: r.templateFile, opts: opts, l: l}
+		rendered, err := first.renderValue(input)
 		if err != nil {
 			return err
 		}
 
-		if args.yaml {
-			err = encoder.Encode(output)
+		chainedContext := make(map[string]interface{}, len(context)+1)
+		for k, v := range context {
+			chainedContext[k] = v
+		}
+		chainedContext[args.chainKey] = rendered
+		r.context = chainedContext
+		if r.used != nil {
+			r.used[args.chainKey] = true
+		}
+
+		chainInput, err := openTemplate(args.chain, opts)
+		if err != nil {
+			return err
+		}
+		defer closeWithError(chainInput)
+		input = chainInput
+		r.templateFile = args.chain
+	}
+
+	renderOutput := func(w io.Writer) error {
+		return r.render(w, input)
+	}
+	if args.assertDeterministic {
+		// warnings were already given by the first load
+		quiet := log.New(ioutil.Discard, "", 0)
+		secondContext, err := loadRenderContext(quiet)
+		if err != nil {
+			return fmt.Errorf("-assert-deterministic: reloading the context: %s", err)
+		}
+		addRegisteredFunctions(quiet, secondContext)
+		second := &renderer{args: args, context: secondContext, outputTemplate: r.outputTemplate, query: r.query, goTemplate: r.goTemplate, templateFile: r.templateFile, opts: opts, l: quiet}
+		if len(args.promptDefaults) > 0 {
+			second.prompt, err = newPrompter(args.promptDefaults, false)
 			if err != nil {
 				return err
 			}
-		} else {
-			var byteOutput []byte
-			if args.indentation == 0 {
-				byteOutput, err = json.Marshal(output)
-			} else {
-				byteOutput, err = json.MarshalIndent(output, "", strings.Repeat(" ", args.indentation))
-				// MarshalIndent, sadly, doesn't add a newline at the end. Which I think it should.
-				byteOutput = append(byteOutput, 0x0a)
+		}
+		rendered, err := r.renderTwice(input, second)
+		if err != nil {
+			return err
+		}
+		renderOutput = func(w io.Writer) error {
+			_, err := w.Write(rendered)
+			return err
+		}
+	}
+
+	if args.diff {
+		if args.outputFile == "-" {
+			return errors.New("-diff requires an output file (-o)")
+		}
+		var buf bytes.Buffer
+		if err := renderOutput(&buf); err != nil {
+			return err
+		}
+		existing, err := ioutil.ReadFile(args.outputFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if compressOutput(args) && len(existing) > 0 {
+			if existing, err = gunzip(existing); err != nil {
+				return fmt.Errorf("%s: %s", args.outputFile, err)
 			}
+		}
+		if err := r.checkUnused(l); err != nil {
+			return err
+		}
+		diff := unifiedDiff(args.outputFile, existing, "rendered", buf.Bytes())
+		if diff == "" {
+			return nil
+		}
+		if _, err := io.WriteString(os.Stdout, diff); err != nil {
+			return err
+		}
+		return errOutputDiffers
+	}
 
+	// Unless we're streaming to stdout (by default, only to a terminal),
+	// render everything before writing anything so a failure doesn't leave
+	// partial output behind for e.g. kubectl apply -f - to act on.
+	if args.outputFile != "-" || args.buffer || (!args.stream && !isTerminal(os.Stdout)) {
+		var buf bytes.Buffer
+		if err := renderOutput(&buf); err != nil {
+			return err
+		}
+		if err := r.checkUnused(l); err != nil {
+			return err
+		}
+		data := buf.Bytes()
+		if args.appendOutput && args.yaml {
+			data, err = yamlAppendSeparator(args.outputFile, data)
 			if err != nil {
 				return err
 			}
-
-			_, err = out.Write(byteOutput)
-			if err != nil {
+		}
+		if compressOutput(args) {
+			// appending adds another gzip member, which gunzip reads
+			// as a continuation of the stream
+			if data, err = gzipData(data); err != nil {
+				return err
+			}
+		}
+		if err := writeOutput(args.outputFile, data, args.appendOutput); err != nil {
+			return err
+		}
+		if args.tee {
+			// just what was rendered, without any separator or compression
+			if err := writeOutput("-", buf.Bytes(), false); err != nil {
 				return err
 			}
 		}
+		if args.manifest != "" {
+			return writeManifest(args.manifest, []string{args.outputFile}, args.manifestHashes)
+		}
+		return nil
+	}
+
+	var out io.Writer = os.Stdout
+	if compressOutput(args) {
+		gz := gzip.NewWriter(os.Stdout)
+		defer closeWithError(gz)
+		out = gz
+	}
+	if err := renderOutput(out); err != nil {
+		return err
 	}
+
+	return r.checkUnused(l)
 }
 
-func loadContext(contexts []context, deepMerge bool) (map[string]interface{}, error) {
+func loadContext(l *log.Logger, contexts []context, args arguments) (map[string]interface{}, error) {
 	finalContext := make(map[string]interface{})
+	// the argument each top level key was last set by
+	sources := make(map[string]string)
+
+	collect := make(map[string]bool)
+	if args.collectDuplicates {
+		counts := make(map[string]int)
+		for _, context := range contexts {
+			if isCollectable(context) {
+				counts[context.key]++
+			}
+		}
+		for k, count := range counts {
+			collect[k] = count > 1
+		}
+	}
 
 	for _, context := range contexts {
+		if collect[context.key] && isCollectable(context) {
+			value, err := context.evalValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := checkDepth(value, args.maxDepth); err != nil {
+				return nil, fmt.Errorf("context %s: %s", context.original, err)
+			}
+			list, _ := finalContext[context.key].([]interface{})
+			finalContext[context.key] = append(list, value)
+			continue
+		}
+
+		if pc, ok := context.content.(*patchContent); ok {
+			var target interface{} = finalContext
+			if len(context.path) > 0 {
+				target = getPath(finalContext, context.path)
+			} else if context.key != "" {
+				target = finalContext[context.key]
+			}
+			patched, err := pc.apply(target)
+			if err == nil {
+				err = checkDepth(patched, args.maxDepth)
+			}
+			if err == nil && len(context.path) > 0 {
+				err = setPath(finalContext, context.path, patched)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("context %s: %s", context.original, err)
+			}
+			if len(context.path) > 0 {
+				continue
+			}
+			if context.key != "" {
+				finalContext[context.key] = patched
+				continue
+			}
+			patchedContext, ok := patched.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("context %s: patch result is %s, not an object with top level keys", context.original, describeType(patched))
+			}
+			finalContext = patchedContext
+			continue
+		}
+
+		if context.deepMerge {
+			if err := deepMergeContext(finalContext, context, args.maxDepth); err != nil {
+				return nil, fmt.Errorf("context %s: %s", context.original, err)
+			}
+			continue
+		}
+
+		if len(context.path) > 0 {
+			// only replace the value at the path, not the whole top level key
+			value, err := context.evalValue()
+			if err == nil {
+				err = checkDepth(wrapPath(context.path, value), args.maxDepth)
+			}
+			if err == nil {
+				err = setPath(finalContext, context.path, value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("context %s: %s", context.original, err)
+			}
+			continue
+		}
+
 		untypedNewContext, err := context.eval()
 		if err != nil {
 			return nil, err
 		}
 
+		if untypedNewContext == nil {
+			// e.g. an empty optional overlay file
+			untypedNewContext = map[string]interface{}{}
+		}
+
+		if list, ok := untypedNewContext.([]interface{}); ok && args.mergeListsKey != "" {
+			existing, ok := finalContext[args.mergeListsKey].([]interface{})
+			if !ok && finalContext[args.mergeListsKey] != nil {
+				return nil, fmt.Errorf("context %s: can't add its list to %q, which is %s (set by %s)", context.original, args.mergeListsKey, describeType(finalContext[args.mergeListsKey]), sources[args.mergeListsKey])
+			}
+			finalContext[args.mergeListsKey] = append(existing[:len(existing):len(existing)], list...)
+			sources[args.mergeListsKey] = context.original
+			continue
+		}
+
 		newContext, ok := untypedNewContext.(map[string]interface{})
 		if !ok {
-			return nil, fmt.Errorf("context %s had no top level keys: %q", context.original, untypedNewContext)
+			keyed := "name:" + context.original
+			if strings.HasPrefix(context.original, ":") {
+				// it already has a format, e.g. :json:file.json
+				keyed = "name" + context.original
+			}
+			return nil, fmt.Errorf("context %s is %s (%s), not an object with top level keys (to use it, give it a key, e.g. %s)", context.original, describeType(untypedNewContext), preview(untypedNewContext), keyed)
 		}
 
-		if deepMerge {
-			err = mergo.Merge(&finalContext, newContext, mergo.WithOverride)
+		if err := checkDepth(newContext, args.maxDepth); err != nil {
+			return nil, fmt.Errorf("context %s: %s", context.original, err)
+		}
+
+		if args.deepMerge {
+			err = deepMergeObjects(finalContext, newContext)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			for k, v := range newContext {
-				finalContext[k] = v
+			for _, k := range sortedKeys(newContext) {
+				if source, ok := sources[k]; ok && args.verbose {
+					l.Printf("Warning: context key %q from %s overwrites the value from %s\n", k, context.original, source)
+				}
+				sources[k] = context.original
+				finalContext[k] = newContext[k]
 			}
 		}
 	}
 
+	// json-e refuses to render with these keys in the context (and they
+	// could never be referenced anyway), so they're dropped.
+	for _, k := range invalidIdentifiers(finalContext) {
+		message := fmt.Sprintf("context key %q is not a valid identifier, so the template can't refer to it; load it under a key (e.g. data:file.yaml) and use data[%q]", k, k)
+		if args.strictKeys {
+			return nil, errors.New(message)
+		}
+		l.Printf("Warning: %s (ignoring it)\n", message)
+		delete(finalContext, k)
+	}
+
 	return finalContext, nil
 }
+
+// isCollectable reports whether the context can be collected into a list
+// by -collect-duplicates (i.e. it has a key and isn't special).
+func isCollectable(context context) bool {
+	switch context.content.(type) {
+	case *listContent, *patchContent:
+		return false
+	}
+	return context.key != "" && len(context.path) == 0 && !context.deepMerge
+}
+
+// deepMergeContext merges a key+: context's value into the value already
+// under its key (if both are objects), as -d does for every context.
+func deepMergeContext(finalContext map[string]interface{}, context context, maxDepth int) error {
+	value, err := context.evalValue()
+	if err != nil {
+		return err
+	}
+
+	path := context.path
+	if len(path) == 0 {
+		path = []string{context.key}
+	}
+
+	existing, existingIsMap := getPath(finalContext, path).(map[string]interface{})
+	valueMap, valueIsMap := value.(map[string]interface{})
+	if existingIsMap && valueIsMap {
+		merged := deepCopy(existing).(map[string]interface{})
+		if err := deepMergeObjects(merged, valueMap); err != nil {
+			return err
+		}
+		value = merged
+	}
+
+	if err := checkDepth(wrapPath(path, value), maxDepth); err != nil {
+		return err
+	}
+	return setPath(finalContext, path, value)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var identifierRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// invalidIdentifiers returns the sorted keys of context that can't be used
+// as json-e identifiers.
+func invalidIdentifiers(context map[string]interface{}) []string {
+	invalid := make([]string, 0)
+	for k := range context {
+		if !identifierRegexp.MatchString(k) {
+			invalid = append(invalid, k)
+		}
+	}
+	sort.Strings(invalid)
+	return invalid
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+)
+
+// manifestEntry describes an output file in the -manifest index when
+// -manifest-hashes is set (otherwise the index is just the paths).
+type manifestEntry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// writeManifest writes a JSON list of the files written by this run to
+// filename, so later steps know exactly what was produced. The hashes
+// are of the files as written (so include anything already there with
+// -append).
+func writeManifest(filename string, written []string, hashes bool) error {
+	var index interface{} = written
+	if hashes {
+		entries := make([]manifestEntry, 0, len(written))
+		for _, path := range written {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(data)
+			entries = append(entries, manifestEntry{Path: path, SHA256: hex.EncodeToString(sum[:])})
+		}
+		index = entries
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(filename, append(data, '\n'), false)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/imdario/mergo"
+)
+
+func init() {
+	builtins["merge"] = mergeBuiltin
+	builtins["deepMerge"] = deepMergeBuiltin
+	builtins["jsonPatch"] = jsonPatchBuiltin
+}
+
+// deepMergeObjects merges src into dst as -d (and key+:) merge contexts:
+// objects are merged recursively, and anything else in src, including a
+// list, replaces the value in dst, except for null, which leaves it as it
+// is. Values from src may end up shared with dst.
+func deepMergeObjects(dst, src map[string]interface{}) error {
+	return mergo.Merge(&dst, src, mergo.WithOverride)
+}
+
+// mergeArguments checks the arguments of merge or deepMerge are objects,
+// treating null as an empty object (as loadContext does an empty file).
+func mergeArguments(name string, args []interface{}) ([]map[string]interface{}, error) {
+	objects := make([]map[string]interface{}, 0, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			continue
+		}
+		object, ok := arg.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: argument %d is %s, not an object", name, i+1, describeType(arg))
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// mergeBuiltin is the default way contexts are merged: each object's top
+// level keys replace those of the objects before it.
+func mergeBuiltin(args ...interface{}) (map[string]interface{}, error) {
+	objects, err := mergeArguments("merge", args)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{})
+	for _, object := range objects {
+		for k, v := range object {
+			result[k] = v
+		}
+	}
+	return result, nil
+}
+
+func deepMergeBuiltin(args ...interface{}) (map[string]interface{}, error) {
+	objects, err := mergeArguments("deepMerge", args)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{})
+	for _, object := range objects {
+		// copied, since merging later objects would otherwise modify
+		// values shared with the context
+		if err := deepMergeObjects(result, deepCopy(object).(map[string]interface{})); err != nil {
+			return nil, fmt.Errorf("deepMerge: %s", err)
+		}
+	}
+	return result, nil
+}
+
+func jsonPatchBuiltin(value interface{}, ops interface{}) (interface{}, error) {
+	result, err := applyJSONPatch(value, ops)
+	if err != nil {
+		return nil, fmt.Errorf("jsonPatch: %s", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// parseNDJSON reads JSON Lines (NDJSON): a JSON value on each line, which
+// become the elements of a list. Blank lines are ignored.
+func parseNDJSON(data []byte) (interface{}, error) {
+	result := []interface{}{}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(line, &value); err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// applyJSONPatch applies an RFC 6902 patch (a list of operations) to a copy
+// of doc.
+func applyJSONPatch(doc interface{}, patch interface{}) (interface{}, error) {
+	ops, ok := patch.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("jsonpatch must be a list of operations, not %s", describeType(patch))
+	}
+
+	doc = deepCopy(doc)
+	for i, rawOp := range ops {
+		var err error
+		doc, err = applyJSONPatchOp(doc, rawOp)
+		if err != nil {
+			return nil, fmt.Errorf("jsonpatch operation %d failed: %s", i, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func applyJSONPatchOp(doc interface{}, rawOp interface{}) (interface{}, error) {
+	op, ok := rawOp.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("operation must be an object, not %s", describeType(rawOp))
+	}
+
+	getString := func(name string) (string, error) {
+		s, ok := op[name].(string)
+		if !ok {
+			return "", fmt.Errorf("%q must be a string", name)
+		}
+		return s, nil
+	}
+
+	opName, err := getString("op")
+	if err != nil {
+		return nil, err
+	}
+	path, err := getString("path")
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opName {
+	case "add", "replace", "test":
+		value, ok := op["value"]
+		if !ok {
+			return nil, fmt.Errorf("%s %s: missing \"value\"", opName, path)
+		}
+		switch opName {
+		case "add":
+			return pointerAdd(doc, tokens, deepCopy(value))
+		case "replace":
+			if len(tokens) == 0 {
+				// the whole document, which can't be removed first
+				return deepCopy(value), nil
+			}
+			if _, err := pointerGet(doc, tokens); err != nil {
+				return nil, fmt.Errorf("replace %s: %s", path, err)
+			}
+			doc, _, err = pointerRemove(doc, tokens)
+			if err != nil {
+				return nil, fmt.Errorf("replace %s: %s", path, err)
+			}
+			return pointerAdd(doc, tokens, deepCopy(value))
+		default:
+			current, err := pointerGet(doc, tokens)
+			if err != nil {
+				return nil, fmt.Errorf("test %s: %s", path, err)
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("test %s: value is %s", path, describeValue(current))
+			}
+			return doc, nil
+		}
+	case "remove":
+		doc, _, err = pointerRemove(doc, tokens)
+		if err != nil {
+			return nil, fmt.Errorf("remove %s: %s", path, err)
+		}
+		return doc, nil
+	case "move", "copy":
+		from, err := getString("from")
+		if err != nil {
+			return nil, err
+		}
+		fromTokens, err := parsePointer(from)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if opName == "move" {
+			if strings.HasPrefix(path, from+"/") {
+				return nil, fmt.Errorf("move %s: cannot move into a child of %s", path, from)
+			}
+			doc, value, err = pointerRemove(doc, fromTokens)
+		} else {
+			value, err = pointerGet(doc, fromTokens)
+			value = deepCopy(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: from %s: %s", opName, path, from, err)
+		}
+		return pointerAdd(doc, tokens, value)
+	default:
+		return nil, fmt.Errorf("unknown op %q", opName)
+	}
+}
+
+// applyMergePatch applies an RFC 7386 merge patch to a copy of target.
+func applyMergePatch(target interface{}, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return deepCopy(patch)
+	}
+
+	targetMap, ok := target.(map[string]interface{})
+	result := make(map[string]interface{}, len(targetMap))
+	if ok {
+		for k, v := range targetMap {
+			result[k] = deepCopy(v)
+		}
+	}
+
+	for k, v := range patchMap {
+		if v == nil {
+			delete(result, k)
+		} else {
+			result[k] = applyMergePatch(result[k], v)
+		}
+	}
+
+	return result
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func pointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	for i, token := range tokens {
+		switch typedDoc := doc.(type) {
+		case map[string]interface{}:
+			v, ok := typedDoc[token]
+			if !ok {
+				keys := make([]string, 0, len(typedDoc))
+				for k := range typedDoc {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				return nil, fmt.Errorf("no key %q at %s (available keys: %s)", token, formatPointer(tokens[:i]), strings.Join(keys, ", "))
+			}
+			doc = v
+		case []interface{}:
+			index, err := arrayIndex(token, len(typedDoc))
+			if err != nil {
+				return nil, fmt.Errorf("%s at %s", err, formatPointer(tokens[:i]))
+			}
+			doc = typedDoc[index]
+		default:
+			return nil, fmt.Errorf("cannot index %s at %s", describeType(doc), formatPointer(tokens[:i]))
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd returns doc with value added at tokens. Containers along the
+// way may be modified in place.
+func pointerAdd(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	parentTokens, last := tokens[:len(tokens)-1], tokens[len(tokens)-1]
+	parent, err := pointerGet(doc, parentTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	switch typedParent := parent.(type) {
+	case map[string]interface{}:
+		typedParent[last] = value
+		return doc, nil
+	case []interface{}:
+		index := len(typedParent)
+		if last != "-" {
+			index, err = arrayIndex(last, len(typedParent)+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		newList := make([]interface{}, 0, len(typedParent)+1)
+		newList = append(newList, typedParent[:index]...)
+		newList = append(newList, value)
+		newList = append(newList, typedParent[index:]...)
+		return pointerAdd(doc, parentTokens, newList)
+	default:
+		return nil, fmt.Errorf("cannot add to %s at %s", describeType(parent), formatPointer(parentTokens))
+	}
+}
+
+// pointerRemove returns doc with the value at tokens removed, and the
+// removed value.
+func pointerRemove(doc interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+
+	value, err := pointerGet(doc, tokens)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parentTokens, last := tokens[:len(tokens)-1], tokens[len(tokens)-1]
+	parent, _ := pointerGet(doc, parentTokens)
+	switch typedParent := parent.(type) {
+	case map[string]interface{}:
+		delete(typedParent, last)
+		return doc, value, nil
+	case []interface{}:
+		index, _ := arrayIndex(last, len(typedParent))
+		newList := make([]interface{}, 0, len(typedParent)-1)
+		newList = append(newList, typedParent[:index]...)
+		newList = append(newList, typedParent[index+1:]...)
+		doc, err = pointerAdd(doc, parentTokens, newList)
+		return doc, value, err
+	}
+
+	// unreachable, since pointerGet succeeded
+	return nil, nil, fmt.Errorf("cannot remove from %s", describeType(parent))
+}
+
+func arrayIndex(token string, length int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index >= length {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+func formatPointer(tokens []string) string {
+	if len(tokens) == 0 {
+		return "/"
+	}
+	escaped := make([]string, len(tokens))
+	for i, token := range tokens {
+		escaped[i] = strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch typedV := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(typedV))
+		for k, child := range typedV {
+			result[k] = deepCopy(child)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(typedV))
+		for i, child := range typedV {
+			result[i] = deepCopy(child)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// describeType gives a user friendly name for the JSON type of v.
+func describeType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "a list"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case float64, int, int64:
+		return "a number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func describeValue(v interface{}) string {
+	return fmt.Sprintf("%s (%v)", describeType(v), v)
+}
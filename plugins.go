@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"plugin"
+	"strings"
+
+	"github.com/wryun/rjsone/ext"
+)
+
+// pluginRegister is the type of the Register symbol a plugin must export.
+// It is given ext.RegisterFunction to call for each of its
+// functions.
+type pluginRegister = func(register func(name string, fn interface{}) error) error
+
+// loadPlugin opens a Go plugin and calls its Register function.
+func loadPlugin(filename string) error {
+	p, err := plugin.Open(filename)
+	if err != nil {
+		return err
+	}
+	symbol, err := p.Lookup("Register")
+	if err != nil {
+		return fmt.Errorf("plugin %s: %s", filename, err)
+	}
+	register, ok := symbol.(pluginRegister)
+	if !ok {
+		return fmt.Errorf("plugin %s: Register is %T, not func(func(string, interface{}) error) error", filename, symbol)
+	}
+	if err := register(ext.RegisterFunction); err != nil {
+		return fmt.Errorf("plugin %s: %s", filename, err)
+	}
+	return nil
+}
+
+// addRegisteredFunctions adds the registered functions to context,
+// unless it already has a key of the same name.
+func addRegisteredFunctions(l *log.Logger, context map[string]interface{}) {
+	for _, name := range ext.Functions() {
+		if _, ok := context[name]; ok {
+			if isBuiltinName(name) {
+				continue
+			}
+			l.Printf("Warning: context key %q overrides the registered function of the same name\n", name)
+			continue
+		}
+		context[name], _ = ext.Function(name)
+	}
+}
+
+// stringsFlag is a flag that can be given more than once.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
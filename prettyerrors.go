@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	jsone "github.com/taskcluster/json-e"
+	"github.com/taskcluster/json-e/interpreter/prattparser"
+	yaml_v2 "gopkg.in/yaml.v2"
+)
+
+// renderError is a json-e error rendering a template document, which
+// -pretty-errors shows in the context of the template.
+type renderError struct {
+	document int
+	template interface{}
+	err      error
+}
+
+func (re *renderError) Error() string {
+	return re.err.Error()
+}
+
+// pretty prints the template with the lines of the node that failed (if
+// it can be found) marked with >>.
+func (re *renderError) pretty() string {
+	path, found := findFailingNode(re.template, re.err)
+
+	var b strings.Builder
+	if found && len(path) == 0 {
+		fmt.Fprintf(&b, "Error rendering document %d at the top level:\n", re.document)
+	} else if found {
+		fmt.Fprintf(&b, "Error rendering document %d at %s:\n", re.document, formatPointer(path))
+	} else {
+		fmt.Fprintf(&b, "Error rendering document %d (couldn't find the failing part of the template):\n", re.document)
+	}
+	for _, l := range templateLines(re.template, nil, path, found) {
+		if l.marked {
+			b.WriteString(">> ")
+		} else {
+			b.WriteString("   ")
+		}
+		b.WriteString(l.text + "\n")
+	}
+	return b.String()
+}
+
+// findFailingNode returns the path of the part of the template that json-e
+// reported as failing. For operators json-e gives us the object itself,
+// and for interpolation only the string (from the point it failed).
+func findFailingNode(template interface{}, err error) ([]string, bool) {
+	switch typedErr := err.(type) {
+	case jsone.TemplateError:
+		if m, ok := typedErr.Template.(map[string]interface{}); ok {
+			target := reflect.ValueOf(m).Pointer()
+			return findNode(template, nil, func(v interface{}) bool {
+				m, ok := v.(map[string]interface{})
+				return ok && reflect.ValueOf(m).Pointer() == target
+			})
+		}
+		return findNode(template, nil, func(v interface{}) bool {
+			return reflect.DeepEqual(v, typedErr.Template)
+		})
+	case prattparser.SyntaxError:
+		return findNode(template, nil, func(v interface{}) bool {
+			s, ok := v.(string)
+			return ok && typedErr.Source != "" && strings.HasSuffix(s, typedErr.Source)
+		})
+	}
+	return nil, false
+}
+
+// findNode searches the template depth first (in key order) for a node
+// that matches.
+func findNode(v interface{}, path []string, matches func(interface{}) bool) ([]string, bool) {
+	if matches(v) {
+		return path, true
+	}
+	switch typedV := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(typedV) {
+			if found, ok := findNode(typedV[k], appendPath(path, k), matches); ok {
+				return found, true
+			}
+		}
+	case []interface{}:
+		for i, child := range typedV {
+			if found, ok := findNode(child, appendPath(path, strconv.Itoa(i)), matches); ok {
+				return found, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func appendPath(path []string, part string) []string {
+	return append(append([]string{}, path...), part)
+}
+
+type templateLine struct {
+	text   string
+	marked bool
+}
+
+// templateLines formats v (at path) as YAML, marking the lines of the
+// node at target if mark is set.
+func templateLines(v interface{}, path []string, target []string, mark bool) []templateLine {
+	lines := templateNodeLines(v, path, target, mark)
+	if mark && reflect.DeepEqual(path, target) {
+		for i := range lines {
+			lines[i].marked = true
+		}
+	}
+	return lines
+}
+
+func templateNodeLines(v interface{}, path []string, target []string, mark bool) []templateLine {
+	switch typedV := v.(type) {
+	case map[string]interface{}:
+		if len(typedV) == 0 {
+			break
+		}
+		var lines []templateLine
+		for _, k := range sortedKeys(typedV) {
+			childPath := appendPath(path, k)
+			key := formatScalar(k)
+			child := templateLines(typedV[k], childPath, target, mark)
+			marked := mark && reflect.DeepEqual(childPath, target)
+			if isScalarLine(typedV[k]) {
+				lines = append(lines, templateLine{text: key + ": " + child[0].text, marked: marked})
+				continue
+			}
+			lines = append(lines, templateLine{text: key + ":", marked: marked})
+			for _, l := range child {
+				lines = append(lines, templateLine{text: "  " + l.text, marked: l.marked})
+			}
+		}
+		return lines
+	case []interface{}:
+		if len(typedV) == 0 {
+			break
+		}
+		var lines []templateLine
+		for i, item := range typedV {
+			child := templateLines(item, appendPath(path, strconv.Itoa(i)), target, mark)
+			for j, l := range child {
+				prefix := "  "
+				if j == 0 {
+					prefix = "- "
+				}
+				lines = append(lines, templateLine{text: prefix + l.text, marked: l.marked})
+			}
+		}
+		return lines
+	}
+	return []templateLine{{text: formatScalar(v)}}
+}
+
+// isScalarLine reports whether v is printed on a single line.
+func isScalarLine(v interface{}) bool {
+	switch typedV := v.(type) {
+	case map[string]interface{}:
+		return len(typedV) == 0
+	case []interface{}:
+		return len(typedV) == 0
+	}
+	return true
+}
+
+// formatScalar formats v for display. This only needs to be readable, so
+// strings are only quoted (as JSON) when they'd otherwise be ambiguous.
+func formatScalar(v interface{}) string {
+	if s, ok := v.(string); ok && !needsQuotes(s) {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func needsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s || strings.ContainsAny(s, "\n\"") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return true
+	}
+	var parsed interface{}
+	// anything that isn't read back as the same string, e.g. true or 1
+	if err := yaml_v2.Unmarshal([]byte(s), &parsed); err != nil {
+		return true
+	}
+	parsedString, ok := parsed.(string)
+	return !ok || parsedString != s
+}
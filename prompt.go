@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var undefinedVariableRegexp = regexp.MustCompile(`^undefined variable ([A-Za-z_][A-Za-z0-9_]*) `)
+
+// undefinedVariable returns the name of the missing context key if err
+// is json-e's undefined variable error.
+func undefinedVariable(err error) (string, bool) {
+	match := undefinedVariableRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// prompter supplies values for context keys the template uses but that
+// weren't given (-prompt and -prompt-default).
+type prompter struct {
+	// defaults are the -prompt-default values, as YAML
+	defaults map[string]string
+	// interactive is set if the user can be asked on the terminal
+	interactive bool
+	in          *bufio.Reader
+	out         io.Writer
+	// asked is the keys supplied so far, so a key that's still undefined
+	// after being supplied fails rather than prompting forever
+	asked map[string]bool
+}
+
+func newPrompter(defaults []string, interactive bool) (*prompter, error) {
+	p := &prompter{
+		defaults:    make(map[string]string, len(defaults)),
+		interactive: interactive,
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stderr,
+		asked:       make(map[string]bool),
+	}
+	for _, d := range defaults {
+		splitDefault := strings.SplitN(d, "=", 2)
+		if len(splitDefault) != 2 || !identifierRegexp.MatchString(splitDefault[0]) {
+			return nil, fmt.Errorf("-prompt-default %q should be key=value", d)
+		}
+		p.defaults[splitDefault[0]] = splitDefault[1]
+	}
+	return p, nil
+}
+
+// value returns the value for key, asking for it if possible, or false
+// if there's no way to supply it.
+func (p *prompter) value(key string) (interface{}, bool, error) {
+	if p.asked[key] {
+		return nil, false, nil
+	}
+	p.asked[key] = true
+
+	answer, hasDefault := p.defaults[key]
+	if p.interactive {
+		if hasDefault {
+			fmt.Fprintf(p.out, "%s [%s]: ", key, answer)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", key)
+		}
+		line, err := p.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, false, fmt.Errorf("reading a value for %s: %s", key, err)
+		}
+		if line = strings.TrimRight(line, "\r\n"); line != "" || !hasDefault {
+			answer = line
+		}
+	} else if !hasDefault {
+		return nil, false, nil
+	}
+
+	value, err := unmarshalYAML([]byte(answer))
+	if err != nil {
+		return nil, false, fmt.Errorf("value for %s: %s", key, err)
+	}
+	return value, true, nil
+}
+
+// isTerminal reports whether f is a terminal (or other character device).
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// parsePrototext does a best-effort structural parse of protobuf text
+// format. Without the message descriptor we can't know which fields
+// are repeated, so a field becomes a list only if it appears more than
+// once (or is written with [list, syntax]). Enum values are strings.
+func parsePrototext(data []byte) (interface{}, error) {
+	p := &prototextParser{input: []rune(string(data)), line: 1}
+	result, err := p.parseFields(0)
+	if err != nil {
+		return nil, fmt.Errorf("prototext line %d: %s", p.line, err)
+	}
+	return result, nil
+}
+
+type prototextParser struct {
+	input []rune
+	pos   int
+	line  int
+}
+
+func (p *prototextParser) skipSpace() {
+	for p.pos < len(p.input) {
+		r := p.input[p.pos]
+		switch {
+		case r == '#':
+			for p.pos < len(p.input) && p.input[p.pos] != '\n' {
+				p.pos++
+			}
+		case r == '\n':
+			p.line++
+			p.pos++
+		case unicode.IsSpace(r):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *prototextParser) peek() rune {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+// parseFields parses fields until the closing delimiter (0 for EOF).
+func (p *prototextParser) parseFields(closing rune) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	for {
+		r := p.peek()
+		if r == closing {
+			if closing != 0 {
+				p.pos++
+			}
+			return result, nil
+		}
+		if r == 0 {
+			return nil, fmt.Errorf("expected %q before end of input", closing)
+		}
+
+		name, err := p.parseFieldName()
+		if err != nil {
+			return nil, err
+		}
+
+		hasColon := false
+		if p.peek() == ':' {
+			hasColon = true
+			p.pos++
+		}
+
+		var value interface{}
+		switch r := p.peek(); {
+		case r == '{' || r == '<':
+			value, err = p.parseMessage()
+		case r == '[':
+			value, err = p.parseList()
+		case !hasColon:
+			err = fmt.Errorf("expected ':' or '{' after field %q", name)
+		default:
+			value, err = p.parseScalar()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		addField(result, name, value)
+
+		if r := p.peek(); r == ',' || r == ';' {
+			p.pos++
+		}
+	}
+}
+
+// addField sets result[name], turning repeated fields into lists.
+func addField(result map[string]interface{}, name string, value interface{}) {
+	existing, ok := result[name]
+	if !ok {
+		result[name] = value
+		return
+	}
+
+	list, isList := existing.([]interface{})
+	if !isList {
+		list = []interface{}{existing}
+	}
+	if valueList, ok := value.([]interface{}); ok {
+		result[name] = append(list, valueList...)
+	} else {
+		result[name] = append(list, value)
+	}
+}
+
+func (p *prototextParser) parseFieldName() (string, error) {
+	if p.peek() == '[' {
+		// extension or Any type URL
+		end := p.pos
+		for end < len(p.input) && p.input[end] != ']' {
+			end++
+		}
+		if end == len(p.input) {
+			return "", fmt.Errorf("unterminated extension name")
+		}
+		name := string(p.input[p.pos : end+1])
+		p.pos = end + 1
+		return name, nil
+	}
+
+	name := p.parseIdentifier()
+	if name == "" {
+		return "", fmt.Errorf("expected field name, found %q", p.peek())
+	}
+	return name, nil
+}
+
+func (p *prototextParser) parseIdentifier() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.input) {
+		r := p.input[p.pos]
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' && r != '-' && r != '+' {
+			break
+		}
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+func (p *prototextParser) parseMessage() (interface{}, error) {
+	closing := '}'
+	if p.input[p.pos] == '<' {
+		closing = '>'
+	}
+	p.pos++
+	return p.parseFields(closing)
+}
+
+func (p *prototextParser) parseList() (interface{}, error) {
+	p.pos++
+	list := make([]interface{}, 0)
+	for {
+		r := p.peek()
+		if r == ']' {
+			p.pos++
+			return list, nil
+		}
+
+		var value interface{}
+		var err error
+		if r == '{' || r == '<' {
+			value, err = p.parseMessage()
+		} else {
+			value, err = p.parseScalar()
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, fmt.Errorf("expected ',' or ']' in list")
+		}
+	}
+}
+
+func (p *prototextParser) parseScalar() (interface{}, error) {
+	r := p.peek()
+	if r == '"' || r == '\'' {
+		// adjacent strings are concatenated
+		var s strings.Builder
+		for r == '"' || r == '\'' {
+			part, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			s.WriteString(part)
+			r = p.peek()
+		}
+		return s.String(), nil
+	}
+
+	token := p.parseIdentifier()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("expected value, found %q", r)
+	case "true", "True", "t":
+		return true, nil
+	case "false", "False", "f":
+		return false, nil
+	}
+
+	if i, err := strconv.ParseInt(token, 0, 64); err == nil {
+		return float64(i), nil
+	}
+	if u, err := strconv.ParseUint(token, 0, 64); err == nil {
+		return float64(u), nil
+	}
+	if f, err := strconv.ParseFloat(strings.TrimRight(token, "fF"), 64); err == nil && !strings.HasPrefix(strings.ToLower(token), "in") && !strings.HasPrefix(strings.ToLower(token), "nan") {
+		return f, nil
+	}
+
+	// must be an enum value (or inf/nan, which JSON can't represent)
+	return token, nil
+}
+
+func (p *prototextParser) parseString() (string, error) {
+	quote := p.input[p.pos]
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.input) && p.input[p.pos] != quote {
+		if p.input[p.pos] == '\n' {
+			return "", fmt.Errorf("newline in string")
+		}
+		if p.input[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.input) {
+		return "", fmt.Errorf("unterminated string")
+	}
+	p.pos++
+
+	quoted := string(p.input[start+1 : p.pos-1])
+	if quote == '\'' {
+		quoted = strings.Replace(strings.Replace(quoted, `\'`, `'`, -1), `"`, `\"`, -1)
+	}
+	s, err := strconv.Unquote(`"` + quoted + `"`)
+	if err != nil {
+		return "", fmt.Errorf("invalid string %s", string(p.input[start:p.pos]))
+	}
+	return s, nil
+}
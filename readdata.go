@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// readDataBuiltin returns the readData(path, format) function added by
+// -base-dir. It reads path (relative to dir, and not outside it) and
+// parses it as format like a context would be, or by its extension (as
+// -auto-format does) if format is "".
+func readDataBuiltin(dir string, opts *loadOptions) func(string, string) (interface{}, error) {
+	return func(filename string, format string) (interface{}, error) {
+		if filepath.IsAbs(filename) {
+			return nil, fmt.Errorf("readData: %s should be relative to -base-dir %s", filename, dir)
+		}
+		resolved, inside, err := insideDir(dir, filepath.Join(dir, filename))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("readData: %s doesn't exist in -base-dir %s", filename, dir)
+		} else if err != nil {
+			return nil, fmt.Errorf("readData: %s", err)
+		}
+		if !inside {
+			return nil, fmt.Errorf("readData: %s is outside -base-dir %s", filename, dir)
+		}
+
+		if format == "" {
+			format = string(inferFileFormat(filename, opts))
+		}
+
+		data, err := opts.readFile(resolved)
+		if err != nil {
+			return nil, fmt.Errorf("readData: %s", err)
+		}
+		result, err := loadBytes(inputFormat(format), data, opts)
+		if err != nil {
+			return nil, fmt.Errorf("readData: %s: %s", filename, err)
+		}
+		return result, nil
+	}
+}
+
+// inferFileFormat is the format readData and readFile use when they're
+// given "": text for -text-extensions, the format for the extension (as
+// with -auto-format), or otherwise YAML.
+func inferFileFormat(filename string, opts *loadOptions) inputFormat {
+	if opts.isTextFile(filename) {
+		return textFormat
+	}
+	if format, ok := formatFromExtension(filename); ok {
+		return format
+	}
+	return yamlFormat
+}
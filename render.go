@@ -0,0 +1,664 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/itchyny/gojq"
+	jsone "github.com/taskcluster/json-e"
+)
+
+// renderer renders templates against the loaded context.
+type renderer struct {
+	args    arguments
+	context map[string]interface{}
+	// outputTemplate, if set, is applied to each rendered document
+	outputTemplate interface{}
+	// query, if not nil, selects the part of each document to output
+	query []string
+	// jq, if set, is the -query jq filter whose outputs are output instead
+	// of each document
+	jq *gojq.Code
+	// goTemplate, if set, formats each document rather than encoding it
+	goTemplate *template.Template
+	// used, if set, collects the identifiers referenced by the template
+	used map[string]bool
+	// trace, if set, prints each document as it's rendered
+	trace *tracer
+	// prompt, if set, supplies missing context keys (-prompt)
+	prompt *prompter
+	// templateFile is the template being rendered (as given to -t), which
+	// $rjsone-include paths are relative to
+	templateFile string
+	// opts confines included files to -root
+	opts *loadOptions
+	// l is where skipped documents are reported (-on-render-error skip)
+	l *log.Logger
+	// recordEnds, if set, collects the number of bytes written by the end
+	// of each document in documentEnds (-assert-deterministic)
+	recordEnds   bool
+	documentEnds []int64
+}
+
+// render every document in the template to out.
+func (r *renderer) render(out io.Writer, input io.Reader) (finalError error) {
+	closeWithError := func(c io.Closer) {
+		if err := c.Close(); err != nil && finalError == nil {
+			finalError = err
+		}
+	}
+
+	if r.args.maxOutputBytes > 0 {
+		out = &limitedWriter{w: out, limit: r.args.maxOutputBytes}
+	}
+	var counter *countingWriter
+	if r.recordEnds {
+		counter = &countingWriter{w: out}
+		out = counter
+	}
+
+	var encoder yamlEncoder
+	if r.args.yaml {
+		if err := writeYAMLHeader(out, r.args); err != nil {
+			return err
+		}
+		encoder = newYAMLEncoder(out, r.args.indents["yaml"])
+		defer closeWithError(encoder)
+	}
+
+	encode := func(output interface{}) error {
+		if r.goTemplate != nil {
+			return r.goTemplate.Execute(out, output)
+		}
+		if r.args.yaml {
+			return encoder.Encode(output)
+		}
+		if r.args.outputFormat == "csv" {
+			return writeCSV(out, output)
+		}
+		if s, ok := output.(string); ok && r.args.rawOutput {
+			_, err := io.WriteString(out, s+"\n")
+			return err
+		}
+
+		var byteOutput []byte
+		var err error
+		if indent := r.args.indents["json"]; indent == "" {
+			byteOutput, err = json.Marshal(output)
+		} else {
+			byteOutput, err = json.MarshalIndent(output, "", indent)
+			// MarshalIndent, sadly, doesn't add a newline at the end. Which I think it should.
+			byteOutput = append(byteOutput, 0x0a)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = out.Write(byteOutput)
+		return err
+	}
+
+	return r.renderDocuments(input, func(output interface{}) error {
+		if err := encode(output); err != nil {
+			return err
+		}
+		if counter != nil {
+			r.documentEnds = append(r.documentEnds, counter.written)
+		}
+		return nil
+	})
+}
+
+// renderDocuments renders every document in the template, passing each
+// result to emit.
+func (r *renderer) renderDocuments(input io.Reader, emit func(interface{}) error) error {
+	var next func() (interface{}, error)
+	var count int
+	var err error
+	if r.args.splitItems {
+		next, count, err = r.readItems(input)
+	} else {
+		next, count, err = r.readDocuments(input)
+	}
+	if err != nil {
+		return err
+	}
+
+	skipped, total := 0, 0
+	for i := 0; ; i++ {
+		template, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		total++
+		document := i + 1
+		template, err = resolveTemplateIncludes(template, r.templateFile, r.opts)
+		if err != nil {
+			return err
+		}
+
+		if r.trace != nil {
+			r.trace.template(document, template, r.context)
+		}
+
+		if r.used != nil {
+			collectIdentifiers(template, r.used)
+		}
+
+		output, err := r.renderTemplate(template, i, count)
+		if err != nil && r.args.onRenderError == "skip" {
+			if r.args.verbose {
+				r.l.Printf("Skipping document %d: %s\n", document, err)
+			}
+			skipped++
+			continue
+		} else if err != nil {
+			return &renderError{document: document, template: template, err: err}
+		}
+
+		if r.outputTemplate != nil {
+			output, err = r.applyOutputTemplate(output)
+			if err != nil {
+				return err
+			}
+		}
+
+		if r.query != nil {
+			output, err = pointerGet(output, r.query)
+			if err != nil {
+				return fmt.Errorf("document %d: -query %s: %s", document, r.args.query, err)
+			}
+		}
+		outputs := []interface{}{output}
+		if r.jq != nil {
+			outputs, err = runJQ(r.jq, output)
+			if err != nil {
+				return fmt.Errorf("document %d: -query %s: %s", document, r.args.query, err)
+			}
+		}
+
+		for _, output := range outputs {
+			if r.trace != nil {
+				r.trace.result(document, output)
+			}
+
+			// checked before encoding, which would otherwise recurse as
+			// deep as the output goes
+			if err := checkDepth(output, r.args.maxDepth); err != nil {
+				return fmt.Errorf("document %d: %s", document, err)
+			}
+
+			if err := emit(output); err != nil {
+				return err
+			}
+		}
+	}
+
+	if skipped > 0 {
+		r.l.Printf("Warning: skipped %d of %d documents that failed to render\n", skipped, total)
+	}
+	return nil
+}
+
+// readDocuments reads every document in the template first, so that the
+// count is known, returning a function that gives each in turn (and
+// io.EOF after the last).
+func (r *renderer) readDocuments(input io.Reader) (func() (interface{}, error), int, error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, 0, err
+	}
+	if data, err = checkEncoding(data); err != nil {
+		return nil, 0, fmt.Errorf("template %s: %s", r.templateFile, err)
+	}
+	var templates []interface{}
+	decoder := newYAMLDecoder(bytes.NewReader(data))
+	for {
+		template, err := decoder.decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		templates = append(templates, template)
+	}
+	if len(templates) == 0 && r.args.requireTemplate {
+		// e.g. an upstream step that should have generated it failed
+		return nil, 0, fmt.Errorf("template %s has no documents (-require-template)", r.templateFile)
+	}
+	return sliceIterator(templates), len(templates), nil
+}
+
+// readItems is readDocuments for -split-items, where the template is a
+// list and each item is a document. A .json template is read an item at
+// a time, so only the item being rendered is in memory, and the count
+// isn't known (-1). Anything else may be YAML (even if it starts with a
+// flow sequence), which can't be read that way, so it's read in full, but
+// each item is dropped once it's been rendered.
+func (r *renderer) readItems(input io.Reader) (func() (interface{}, error), int, error) {
+	buffered := bufio.NewReader(input)
+	if format, ok := formatFromExtension(r.templateFile); ok && format == jsonFormat {
+		offset := 0
+		if bom, err := buffered.Peek(len(utf8BOM)); err == nil && bytes.Equal(bom, utf8BOM) {
+			if _, err := buffered.Discard(len(utf8BOM)); err != nil {
+				return nil, 0, err
+			}
+			offset = len(utf8BOM)
+		}
+		if first, err := firstNonSpace(buffered); err == nil && first == '[' {
+			decoder := json.NewDecoder(&utf8Reader{r: buffered, offset: offset})
+			return jsonItemIterator(decoder, r.templateFile), -1, nil
+		}
+	}
+
+	next, count, err := r.readDocuments(buffered)
+	if err != nil {
+		return nil, 0, err
+	}
+	template, _ := next()
+	items, ok := template.([]interface{})
+	if count != 1 || !ok {
+		return nil, 0, fmt.Errorf("-split-items: template %s should be a single list, not %s", r.templateFile, describeTemplateDocuments(count, template))
+	}
+	return sliceIterator(items), len(items), nil
+}
+
+// describeTemplateDocuments describes why a template isn't a single list.
+func describeTemplateDocuments(count int, template interface{}) string {
+	if count != 1 {
+		return fmt.Sprintf("%d documents", count)
+	}
+	return describeType(template)
+}
+
+// sliceIterator returns each value in turn, clearing it so that it can be
+// freed once it's rendered, then io.EOF.
+func sliceIterator(values []interface{}) func() (interface{}, error) {
+	i := 0
+	return func() (interface{}, error) {
+		if i == len(values) {
+			return nil, io.EOF
+		}
+		value := values[i]
+		values[i] = nil
+		i++
+		return value, nil
+	}
+}
+
+// jsonItemIterator returns each item of the JSON list being read by
+// decoder, then io.EOF.
+func jsonItemIterator(decoder *json.Decoder, templateFile string) func() (interface{}, error) {
+	started := false
+	return func() (interface{}, error) {
+		if !started {
+			started = true
+			if _, err := decoder.Token(); err != nil {
+				return nil, fmt.Errorf("template %s: %s", templateFile, err)
+			}
+		}
+		if !decoder.More() {
+			if _, err := decoder.Token(); err != nil {
+				return nil, fmt.Errorf("template %s: %s", templateFile, err)
+			}
+			if _, err := decoder.Token(); err != io.EOF {
+				return nil, fmt.Errorf("-split-items: template %s has more after the list", templateFile)
+			}
+			return nil, io.EOF
+		}
+		var item interface{}
+		if err := decoder.Decode(&item); err != nil {
+			return nil, fmt.Errorf("template %s: %s", templateFile, err)
+		}
+		return item, nil
+	}
+}
+
+// firstNonSpace returns the first byte of r that isn't whitespace, without
+// consuming it.
+func firstNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b[0])) {
+			return b[0], nil
+		}
+		if _, err := r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// documentKey is the context key with details of the document being
+// rendered, unless the context already has a key with that name.
+const documentKey = "rjsone"
+
+// documentContext is the context for rendering the document at index
+// (from 0) of count (-1 if unknown), which has documentKey added.
+func (r *renderer) documentContext(index, count int) map[string]interface{} {
+	details := map[string]interface{}{}
+	if existing, ok := r.context[documentKey]; ok {
+		// -inject-env-facts uses the same key by default, so its facts
+		// are kept alongside the document's details
+		facts, isMap := existing.(map[string]interface{})
+		if string(r.args.envFacts) != documentKey || !isMap {
+			return r.context
+		}
+		for k, v := range facts {
+			details[k] = v
+		}
+	}
+	context := make(map[string]interface{}, len(r.context)+1)
+	for k, v := range r.context {
+		context[k] = v
+	}
+	details["documentIndex"] = float64(index)
+	if count >= 0 {
+		// unknown when -split-items reads a JSON template as it goes
+		details["documentCount"] = float64(count)
+	}
+	context[documentKey] = details
+	return context
+}
+
+// renderTemplate renders a single document with json-e. With -prompt,
+// the document is rendered again each time a missing key is supplied.
+func (r *renderer) renderTemplate(template interface{}, index, count int) (interface{}, error) {
+	for {
+		output, err := jsone.Render(template, r.documentContext(index, count))
+		if err == nil || r.prompt == nil {
+			return output, err
+		}
+		key, ok := undefinedVariable(err)
+		if !ok {
+			return nil, err
+		}
+		value, ok, promptErr := r.prompt.value(key)
+		if promptErr != nil {
+			return nil, promptErr
+		}
+		if !ok {
+			return nil, err
+		}
+		r.context[key] = value
+	}
+}
+
+// renderValue renders the template, returning its document (or a list of
+// its documents, if there isn't exactly one).
+func (r *renderer) renderValue(input io.Reader) (interface{}, error) {
+	documents := []interface{}{}
+	err := r.renderDocuments(input, func(output interface{}) error {
+		documents = append(documents, output)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) == 1 {
+		return documents[0], nil
+	}
+	return documents, nil
+}
+
+// parseQuery parses -query, which is a JSON pointer, a dotted path such
+// as metadata.name or items.0, or otherwise a jq filter (which is
+// compiled, so that a mistake is reported before anything is rendered).
+func parseQuery(query string) ([]string, *gojq.Code, error) {
+	switch {
+	case strings.HasPrefix(query, "/"):
+		pointer, err := parsePointer(query)
+		return pointer, nil, err
+	case dottedPathRegexp.MatchString(query):
+		return splitKeyPath(query), nil, nil
+	}
+	code, err := compileJQ(query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("-query %s: %s", query, err)
+	}
+	return nil, code, nil
+}
+
+// limitedWriter fails once more than limit bytes would be written.
+type limitedWriter struct {
+	w       io.Writer
+	limit   int64
+	written int64
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if lw.written+int64(len(p)) > lw.limit {
+		return 0, fmt.Errorf("rendered output is larger than %d bytes (see -max-output-bytes)", lw.limit)
+	}
+	lw.written += int64(len(p))
+	return lw.w.Write(p)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.written += int64(n)
+	return n, err
+}
+
+// isTemplateFile reports whether -t names a file (rather than stdin, a
+// +raw template, a URL or an archive member).
+func isTemplateFile(templateFile string) bool {
+	if _, _, ok := splitArchive(templateFile); ok {
+		return false
+	}
+	return templateFile != "-" && !strings.HasPrefix(templateFile, "+") && !uriRegexp.MatchString(templateFile)
+}
+
+// openTemplate opens the template given with -t.
+func openTemplate(templateFile string, opts *loadOptions) (io.ReadCloser, error) {
+	switch {
+	case templateFile == "-":
+		return ioutil.NopCloser(os.Stdin), nil
+	case strings.HasPrefix(templateFile, "+"):
+		return ioutil.NopCloser(strings.NewReader(templateFile[1:])), nil
+	}
+
+	if match := uriRegexp.FindStringSubmatch(templateFile); match != nil {
+		source, err := lookupURISource(match[1], match[2])
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %s", templateFile, err)
+		}
+		data, _, err := source.fetch(match[2])
+		if err != nil {
+			return nil, fmt.Errorf("fetching template %s: %s", templateFile, err)
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	archiveFile, member, ok := splitArchive(templateFile)
+	if ok {
+		a, err := opts.openArchive(archiveFile, opts.readRaw)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %s", templateFile, err)
+		}
+		data, err := a.member(member)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %s", templateFile, err)
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	return opts.open(archiveFile)
+}
+
+// loadTemplateFile loads a template that must have exactly one document.
+func loadTemplateFile(filename string, opts *loadOptions) (interface{}, error) {
+	data, err := opts.readRaw(filename)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = checkEncoding(data); err != nil {
+		return nil, fmt.Errorf("template %s: %s", filename, err)
+	}
+
+	decoder := newYAMLDecoder(bytes.NewReader(data))
+	template, err := decoder.decode()
+	if err == io.EOF {
+		return nil, fmt.Errorf("template %s is empty", filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.decode(); err != io.EOF {
+		return nil, fmt.Errorf("template %s should only have one document", filename)
+	}
+	return template, nil
+}
+
+// applyOutputTemplate renders the output template with the rendered
+// document available as doc, which a context key can't also be.
+func (r *renderer) applyOutputTemplate(doc interface{}) (interface{}, error) {
+	if _, ok := r.context["doc"]; ok {
+		return nil, errors.New("output template: the context has a doc key, which would be hidden by the rendered document")
+	}
+	context := make(map[string]interface{}, len(r.context)+1)
+	for k, v := range r.context {
+		context[k] = v
+	}
+	context["doc"] = doc
+
+	output, err := jsone.Render(r.outputTemplate, context)
+	if err != nil {
+		return nil, fmt.Errorf("output template: %s", err)
+	}
+	return output, nil
+}
+
+// checkUnused reports context keys that were never used by the template.
+func (r *renderer) checkUnused(l *log.Logger) error {
+	if r.used == nil {
+		return nil
+	}
+
+	unused := unusedKeys(r.context, r.used)
+	if len(unused) == 0 {
+		return nil
+	}
+
+	if r.args.strictUnused {
+		return fmt.Errorf("unused context keys: %s", strings.Join(unused, ", "))
+	}
+	l.Printf("Unused context keys: %s\n", strings.Join(unused, ", "))
+	return nil
+}
+
+// writeYAMLHeader writes anything that should appear before the first
+// YAML document. JSON has no comment syntax, so the banner is only
+// emitted for YAML output, and only at the top of the file (so not when
+// -append adds to one that already has content).
+func writeYAMLHeader(out io.Writer, args arguments) error {
+	banner, err := readBanner(args)
+	if err != nil {
+		return err
+	}
+	if args.appendOutput {
+		info, err := os.Stat(args.outputFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil && info.Size() > 0 {
+			banner = ""
+		}
+	}
+
+	if banner != "" {
+		var b strings.Builder
+		for _, line := range strings.Split(strings.TrimRight(banner, "\n"), "\n") {
+			if line == "" {
+				b.WriteString("#\n")
+			} else {
+				b.WriteString("# " + line + "\n")
+			}
+		}
+		if _, err := io.WriteString(out, b.String()); err != nil {
+			return err
+		}
+	}
+
+	if args.yamlLeadingSeparator {
+		if _, err := io.WriteString(out, "---\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readBanner returns the text of -banner or -banner-file.
+func readBanner(args arguments) (string, error) {
+	if args.bannerFile == "" {
+		return args.banner, nil
+	}
+	banner, err := ioutil.ReadFile(args.bannerFile)
+	if err != nil {
+		return "", err
+	}
+	return string(banner), nil
+}
+
+// writeOutput writes data to filename (- is stdout).
+func writeOutput(filename string, data []byte, appendOutput bool) (finalError error) {
+	if filename == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendOutput {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	out, err := os.OpenFile(filename, flags, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := out.Close(); err != nil && finalError == nil {
+			finalError = err
+		}
+	}()
+
+	_, err = out.Write(data)
+	return err
+}
+
+// yamlAppendSeparator adds a document separator to the start of data if
+// it's being appended to a non-empty file, so the result is still a valid
+// YAML stream.
+func yamlAppendSeparator(filename string, data []byte) ([]byte, error) {
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return data, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 || bytes.HasPrefix(data, []byte("---")) {
+		return data, nil
+	}
+	return append([]byte("---\n"), data...), nil
+}
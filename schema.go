@@ -0,0 +1,566 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaDepth limits how deeply schemas can nest (including through
+// $refs), so a $ref loop is an error rather than a stack overflow.
+const maxSchemaDepth = 100
+
+// validateSchemaBuiltin is the validateSchema(schema, value) function
+// added by -enable-schema. It returns value unchanged if it matches the
+// JSON Schema (draft-07), and otherwise fails listing every violation.
+func validateSchemaBuiltin(schema interface{}, value interface{}) (interface{}, error) {
+	v := &schemaValidator{root: schema}
+	violations, err := v.check(schema, value, nil, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("validateSchema: %s", err)
+	}
+	if len(violations) > 0 {
+		return nil, fmt.Errorf("validateSchema: value doesn't match the schema: %s", strings.Join(violations, "; "))
+	}
+	return value, nil
+}
+
+// schemaValidator checks values against a schema. Only local $refs (to
+// somewhere in root) are supported, and format is just an annotation.
+type schemaValidator struct {
+	root interface{}
+	// patterns compiled so far
+	patterns map[string]*regexp.Regexp
+}
+
+// check returns the ways value (at path) doesn't match schema (at
+// schemaPath), or an error if the schema itself is invalid.
+func (v *schemaValidator) check(schema interface{}, value interface{}, path []string, schemaPath []string, depth int) ([]string, error) {
+	if depth > maxSchemaDepth {
+		return nil, fmt.Errorf("schema nested more than %d deep at %s (is there a $ref loop?)", maxSchemaDepth, schemaLocation(schemaPath))
+	}
+
+	switch typedSchema := schema.(type) {
+	case bool:
+		if typedSchema {
+			return nil, nil
+		}
+		return []string{fmt.Sprintf("%s: not allowed (the schema at %s is false)", formatPointer(path), schemaLocation(schemaPath))}, nil
+	case map[string]interface{}:
+		if ref, ok := typedSchema["$ref"]; ok {
+			// in draft-07, $ref replaces any other keywords
+			return v.checkRef(ref, value, path, schemaPath, depth)
+		}
+		c := &schemaCheck{v: v, schema: typedSchema, value: value, path: path, schemaPath: schemaPath, depth: depth}
+		return c.run()
+	default:
+		return nil, fmt.Errorf("the schema at %s is %s, not an object or boolean", schemaLocation(schemaPath), describeType(schema))
+	}
+}
+
+func (v *schemaValidator) checkRef(ref interface{}, value interface{}, path []string, schemaPath []string, depth int) ([]string, error) {
+	refString, ok := ref.(string)
+	if !ok || !strings.HasPrefix(refString, "#") {
+		return nil, fmt.Errorf("$ref %v at %s: only local references (e.g. #/definitions/port) are supported", ref, schemaLocation(schemaPath))
+	}
+	tokens, err := parsePointer(refString[1:])
+	if err != nil {
+		return nil, fmt.Errorf("$ref at %s: %s", schemaLocation(schemaPath), err)
+	}
+	target, err := pointerGet(v.root, tokens)
+	if err != nil {
+		return nil, fmt.Errorf("$ref %s at %s: %s", refString, schemaLocation(schemaPath), err)
+	}
+	return v.check(target, value, path, tokens, depth+1)
+}
+
+func (v *schemaValidator) pattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := v.patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if v.patterns == nil {
+		v.patterns = make(map[string]*regexp.Regexp)
+	}
+	v.patterns[pattern] = re
+	return re, nil
+}
+
+// schemaLocation formats a path in the schema as a JSON pointer fragment,
+// as $refs are written.
+func schemaLocation(schemaPath []string) string {
+	if len(schemaPath) == 0 {
+		return "#"
+	}
+	return "#" + formatPointer(schemaPath)
+}
+
+// schemaCheck is the checking of one value against one schema object.
+type schemaCheck struct {
+	v          *schemaValidator
+	schema     map[string]interface{}
+	value      interface{}
+	path       []string
+	schemaPath []string
+	depth      int
+
+	violations []string
+}
+
+func (c *schemaCheck) run() ([]string, error) {
+	// the keywords are checked in the same order every time, so the
+	// violations are too
+	checks := []func() error{
+		c.checkType,
+		c.checkEnum,
+		c.checkNumber,
+		c.checkString,
+		c.checkArray,
+		c.checkObject,
+		c.checkCombinators,
+	}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return nil, err
+		}
+	}
+	return c.violations, nil
+}
+
+func (c *schemaCheck) fail(format string, args ...interface{}) {
+	c.violations = append(c.violations, formatPointer(c.path)+": "+fmt.Sprintf(format, args...))
+}
+
+// sub checks a child value against a subschema under keyword.
+func (c *schemaCheck) sub(value interface{}, path []string, keyword ...string) ([]string, error) {
+	schemaPath := append(append([]string{}, c.schemaPath...), keyword...)
+	subschema, _ := pointerGet(c.schema, keyword)
+	return c.v.check(subschema, value, path, schemaPath, c.depth+1)
+}
+
+func (c *schemaCheck) invalid(keyword string, expected string) error {
+	return fmt.Errorf("%s at %s should be %s", keyword, schemaLocation(c.schemaPath), expected)
+}
+
+// number returns the numeric keyword, if it's there.
+func (c *schemaCheck) number(keyword string) (float64, bool, error) {
+	raw, ok := c.schema[keyword]
+	if !ok {
+		return 0, false, nil
+	}
+	n, ok := raw.(float64)
+	if !ok {
+		return 0, false, c.invalid(keyword, "a number")
+	}
+	return n, true, nil
+}
+
+// count returns the non-negative integer keyword (e.g. minLength), or -1
+// if it's not there.
+func (c *schemaCheck) count(keyword string) (int, error) {
+	n, ok, err := c.number(keyword)
+	if err != nil || !ok {
+		return -1, err
+	}
+	if n < 0 || n != math.Trunc(n) {
+		return -1, c.invalid(keyword, "a non-negative integer")
+	}
+	return int(n), nil
+}
+
+// schemaType returns the JSON Schema type of value, with whole numbers
+// being integers.
+func schemaType(value interface{}) string {
+	switch typedValue := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if typedValue == math.Trunc(typedValue) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func (c *schemaCheck) checkType() error {
+	raw, ok := c.schema["type"]
+	if !ok {
+		return nil
+	}
+	var types []string
+	switch typedRaw := raw.(type) {
+	case string:
+		types = []string{typedRaw}
+	case []interface{}:
+		for _, t := range typedRaw {
+			s, ok := t.(string)
+			if !ok {
+				return c.invalid("type", "a type name or list of them")
+			}
+			types = append(types, s)
+		}
+	default:
+		return c.invalid("type", "a type name or list of them")
+	}
+
+	actual := schemaType(c.value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return nil
+		}
+	}
+	c.fail("should be %s, not %s", strings.Join(types, " or "), describeType(c.value))
+	return nil
+}
+
+func (c *schemaCheck) checkEnum() error {
+	if raw, ok := c.schema["enum"]; ok {
+		values, ok := raw.([]interface{})
+		if !ok {
+			return c.invalid("enum", "a list")
+		}
+		found := false
+		for _, allowed := range values {
+			if reflect.DeepEqual(allowed, c.value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.fail("%s isn't one of %s", preview(c.value), preview(values))
+		}
+	}
+	if constant, ok := c.schema["const"]; ok && !reflect.DeepEqual(constant, c.value) {
+		c.fail("%s should be %s", preview(c.value), preview(constant))
+	}
+	return nil
+}
+
+func (c *schemaCheck) checkNumber() error {
+	n, ok := c.value.(float64)
+	if !ok {
+		return nil
+	}
+	bounds := []struct {
+		keyword  string
+		violated func(bound float64) bool
+		message  string
+	}{
+		{"minimum", func(bound float64) bool { return n < bound }, "at least"},
+		{"maximum", func(bound float64) bool { return n > bound }, "at most"},
+		{"exclusiveMinimum", func(bound float64) bool { return n <= bound }, "more than"},
+		{"exclusiveMaximum", func(bound float64) bool { return n >= bound }, "less than"},
+	}
+	for _, b := range bounds {
+		bound, ok, err := c.number(b.keyword)
+		if err != nil {
+			return err
+		}
+		if ok && b.violated(bound) {
+			c.fail("%v should be %s %v", n, b.message, bound)
+		}
+	}
+
+	multipleOf, ok, err := c.number("multipleOf")
+	if err != nil {
+		return err
+	}
+	if ok {
+		if multipleOf <= 0 {
+			return c.invalid("multipleOf", "more than 0")
+		}
+		if quotient := n / multipleOf; quotient != math.Trunc(quotient) {
+			c.fail("%v should be a multiple of %v", n, multipleOf)
+		}
+	}
+	return nil
+}
+
+func (c *schemaCheck) checkString() error {
+	s, ok := c.value.(string)
+	if !ok {
+		return nil
+	}
+	length := utf8.RuneCountInString(s)
+	if minLength, err := c.count("minLength"); err != nil {
+		return err
+	} else if minLength >= 0 && length < minLength {
+		c.fail("%s should be at least %d characters", preview(s), minLength)
+	}
+	if maxLength, err := c.count("maxLength"); err != nil {
+		return err
+	} else if maxLength >= 0 && length > maxLength {
+		c.fail("%s should be at most %d characters", preview(s), maxLength)
+	}
+
+	if raw, ok := c.schema["pattern"]; ok {
+		pattern, ok := raw.(string)
+		if !ok {
+			return c.invalid("pattern", "a string")
+		}
+		re, err := c.v.pattern(pattern)
+		if err != nil {
+			return fmt.Errorf("pattern at %s: %s", schemaLocation(c.schemaPath), err)
+		}
+		if !re.MatchString(s) {
+			c.fail("%s doesn't match the pattern %s", preview(s), pattern)
+		}
+	}
+	return nil
+}
+
+func (c *schemaCheck) checkArray() error {
+	list, ok := c.value.([]interface{})
+	if !ok {
+		return nil
+	}
+	if minItems, err := c.count("minItems"); err != nil {
+		return err
+	} else if minItems >= 0 && len(list) < minItems {
+		c.fail("should have at least %d items, not %d", minItems, len(list))
+	}
+	if maxItems, err := c.count("maxItems"); err != nil {
+		return err
+	} else if maxItems >= 0 && len(list) > maxItems {
+		c.fail("should have at most %d items, not %d", maxItems, len(list))
+	}
+
+	if unique, _ := c.schema["uniqueItems"].(bool); unique {
+		for i := range list {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(list[i], list[j]) {
+					c.fail("items %d and %d are the same, but should be unique", j, i)
+				}
+			}
+		}
+	}
+
+	switch items := c.schema["items"].(type) {
+	case nil:
+	case []interface{}:
+		// a schema for each position, then additionalItems for the rest
+		for i, item := range list {
+			var violations []string
+			var err error
+			if i < len(items) {
+				violations, err = c.sub(item, appendPath(c.path, fmt.Sprint(i)), "items", fmt.Sprint(i))
+			} else if _, ok := c.schema["additionalItems"]; ok {
+				violations, err = c.sub(item, appendPath(c.path, fmt.Sprint(i)), "additionalItems")
+			}
+			if err != nil {
+				return err
+			}
+			c.violations = append(c.violations, violations...)
+		}
+	default:
+		for i, item := range list {
+			violations, err := c.sub(item, appendPath(c.path, fmt.Sprint(i)), "items")
+			if err != nil {
+				return err
+			}
+			c.violations = append(c.violations, violations...)
+		}
+	}
+
+	if _, ok := c.schema["contains"]; ok {
+		for i, item := range list {
+			violations, err := c.sub(item, appendPath(c.path, fmt.Sprint(i)), "contains")
+			if err != nil {
+				return err
+			}
+			if len(violations) == 0 {
+				return nil
+			}
+		}
+		c.fail("no item matches the contains schema")
+	}
+	return nil
+}
+
+func (c *schemaCheck) checkObject() error {
+	object, ok := c.value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if minProperties, err := c.count("minProperties"); err != nil {
+		return err
+	} else if minProperties >= 0 && len(object) < minProperties {
+		c.fail("should have at least %d keys, not %d", minProperties, len(object))
+	}
+	if maxProperties, err := c.count("maxProperties"); err != nil {
+		return err
+	} else if maxProperties >= 0 && len(object) > maxProperties {
+		c.fail("should have at most %d keys, not %d", maxProperties, len(object))
+	}
+
+	if raw, ok := c.schema["required"]; ok {
+		required, ok := raw.([]interface{})
+		if !ok {
+			return c.invalid("required", "a list of keys")
+		}
+		for _, key := range required {
+			if _, ok := object[fmt.Sprint(key)]; !ok {
+				c.fail("missing the required key %q", key)
+			}
+		}
+	}
+
+	properties, _ := c.schema["properties"].(map[string]interface{})
+	patternProperties, _ := c.schema["patternProperties"].(map[string]interface{})
+	_, hasPropertyNames := c.schema["propertyNames"]
+	_, hasAdditional := c.schema["additionalProperties"]
+	for _, key := range sortedKeys(object) {
+		path := appendPath(c.path, key)
+		matched := false
+		if _, ok := properties[key]; ok {
+			matched = true
+			if err := c.appendSub(object[key], path, "properties", key); err != nil {
+				return err
+			}
+		}
+		for _, pattern := range sortedKeys(patternProperties) {
+			re, err := c.v.pattern(pattern)
+			if err != nil {
+				return fmt.Errorf("patternProperties at %s: %s", schemaLocation(c.schemaPath), err)
+			}
+			if re.MatchString(key) {
+				matched = true
+				if err := c.appendSub(object[key], path, "patternProperties", pattern); err != nil {
+					return err
+				}
+			}
+		}
+		if !matched && hasAdditional {
+			violations, err := c.sub(object[key], path, "additionalProperties")
+			if err != nil {
+				return err
+			}
+			if additional, ok := c.schema["additionalProperties"].(bool); ok && !additional && len(violations) > 0 {
+				violations = []string{fmt.Sprintf("%s: isn't an allowed key", formatPointer(path))}
+			}
+			c.violations = append(c.violations, violations...)
+		}
+		if hasPropertyNames {
+			violations, err := c.sub(key, path, "propertyNames")
+			if err != nil {
+				return err
+			}
+			if len(violations) > 0 {
+				c.fail("the key %q doesn't match propertyNames", key)
+			}
+		}
+	}
+
+	if raw, ok := c.schema["dependencies"]; ok {
+		dependencies, ok := raw.(map[string]interface{})
+		if !ok {
+			return c.invalid("dependencies", "an object")
+		}
+		for _, key := range sortedKeys(dependencies) {
+			if _, ok := object[key]; !ok {
+				continue
+			}
+			if required, ok := dependencies[key].([]interface{}); ok {
+				for _, dependency := range required {
+					if _, ok := object[fmt.Sprint(dependency)]; !ok {
+						c.fail("has %q, so should also have %q", key, dependency)
+					}
+				}
+				continue
+			}
+			if err := c.appendSub(c.value, c.path, "dependencies", key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *schemaCheck) appendSub(value interface{}, path []string, keyword ...string) error {
+	violations, err := c.sub(value, path, keyword...)
+	if err != nil {
+		return err
+	}
+	c.violations = append(c.violations, violations...)
+	return nil
+}
+
+func (c *schemaCheck) checkCombinators() error {
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		raw, ok := c.schema[keyword]
+		if !ok {
+			continue
+		}
+		subschemas, ok := raw.([]interface{})
+		if !ok || len(subschemas) == 0 {
+			return c.invalid(keyword, "a non-empty list of schemas")
+		}
+
+		var failures []string
+		matches := 0
+		for i := range subschemas {
+			violations, err := c.sub(c.value, c.path, keyword, fmt.Sprint(i))
+			if err != nil {
+				return err
+			}
+			if len(violations) == 0 {
+				matches++
+			} else if keyword == "allOf" {
+				c.violations = append(c.violations, violations...)
+			} else {
+				failures = append(failures, violations...)
+			}
+		}
+
+		switch {
+		case keyword == "anyOf" && matches == 0:
+			c.fail("doesn't match any of the anyOf schemas (%s)", strings.Join(failures, "; "))
+		case keyword == "oneOf" && matches == 0:
+			c.fail("doesn't match any of the oneOf schemas (%s)", strings.Join(failures, "; "))
+		case keyword == "oneOf" && matches > 1:
+			c.fail("matches %d of the oneOf schemas, rather than exactly one", matches)
+		}
+	}
+
+	if _, ok := c.schema["not"]; ok {
+		violations, err := c.sub(c.value, c.path, "not")
+		if err != nil {
+			return err
+		}
+		if len(violations) == 0 {
+			c.fail("matches the not schema at %s", schemaLocation(appendPath(c.schemaPath, "not")))
+		}
+	}
+
+	if _, ok := c.schema["if"]; ok {
+		violations, err := c.sub(c.value, c.path, "if")
+		if err != nil {
+			return err
+		}
+		branch := "then"
+		if len(violations) > 0 {
+			branch = "else"
+		}
+		if _, ok := c.schema[branch]; ok {
+			if err := c.appendSub(c.value, c.path, branch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
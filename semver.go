@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	builtins["semverParse"] = semverParseBuiltin
+	builtins["semverCompare"] = semverCompareBuiltin
+}
+
+// semver is a semantic version (https://semver.org).
+type semver struct {
+	major, minor, patch uint64
+	prerelease          string
+	metadata            string
+}
+
+var (
+	semverIdentifiers = `[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*`
+	// semverRegexp allows a leading v and a missing minor or patch
+	// version (which are 0), as versions are often written that way
+	semverRegexp = regexp.MustCompile(`^v?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?(?:-(` + semverIdentifiers + `))?(?:\+(` + semverIdentifiers + `))?$`)
+	// semverPartialRegexp is a version in a constraint, where x, X or *
+	// (or leaving off the end) matches any value
+	semverPartialRegexp = regexp.MustCompile(`^v?([0-9]+|[xX*])(?:\.([0-9]+|[xX*]))?(?:\.([0-9]+|[xX*]))?(?:-(` + semverIdentifiers + `))?(?:\+(` + semverIdentifiers + `))?$`)
+)
+
+func parseSemver(s string) (semver, error) {
+	match := semverRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return semver{}, fmt.Errorf("invalid version %q", s)
+	}
+	var parts [3]uint64
+	for i := range parts {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(match[i+1], 10, 64)
+		if err != nil {
+			return semver{}, fmt.Errorf("invalid version %q: %s", s, err)
+		}
+		parts[i] = n
+	}
+	return semver{major: parts[0], minor: parts[1], patch: parts[2], prerelease: match[4], metadata: match[5]}, nil
+}
+
+// compare returns -1, 0 or 1 as v is less than, equal to or greater
+// than other, ignoring metadata as semver requires.
+func (v semver) compare(other semver) int {
+	for _, pair := range [][2]uint64{{v.major, other.major}, {v.minor, other.minor}, {v.patch, other.patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrerelease(v.prerelease, other.prerelease)
+}
+
+// comparePrerelease compares prerelease versions, where having none is
+// greater than having one (1.0.0-rc.1 < 1.0.0).
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	aIdentifiers, bIdentifiers := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aIdentifiers) && i < len(bIdentifiers); i++ {
+		aID, bID := aIdentifiers[i], bIdentifiers[i]
+		if aID == bID {
+			continue
+		}
+		aNum, aErr := strconv.ParseUint(aID, 10, 64)
+		bNum, bErr := strconv.ParseUint(bID, 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		case aErr == nil:
+			// numeric identifiers are lower than alphanumeric ones
+			return -1
+		case bErr == nil:
+			return 1
+		case aID < bID:
+			return -1
+		default:
+			return 1
+		}
+	}
+	switch {
+	case len(aIdentifiers) < len(bIdentifiers):
+		return -1
+	case len(aIdentifiers) > len(bIdentifiers):
+		return 1
+	}
+	return 0
+}
+
+// semverRange is a version in a constraint, which may be partial (e.g.
+// 1.2 or 1.2.x): the versions from lower up to (but not including) upper.
+type semverRange struct {
+	lower semver
+	// upper is nil if there's no limit (i.e. *), or for a full version
+	upper *semver
+	// parts is how many of major, minor and patch were given
+	parts int
+}
+
+func parseSemverRange(s string) (semverRange, error) {
+	match := semverPartialRegexp.FindStringSubmatch(s)
+	if match == nil {
+		return semverRange{}, fmt.Errorf("invalid version %q", s)
+	}
+
+	var numbers [3]uint64
+	parts := 0
+	for i := 0; i < 3; i++ {
+		if match[i+1] == "" || strings.ContainsAny(match[i+1], "xX*") {
+			break
+		}
+		n, err := strconv.ParseUint(match[i+1], 10, 64)
+		if err != nil {
+			return semverRange{}, fmt.Errorf("invalid version %q: %s", s, err)
+		}
+		numbers[i] = n
+		parts++
+	}
+
+	r := semverRange{lower: semver{major: numbers[0], minor: numbers[1], patch: numbers[2]}, parts: parts}
+	switch parts {
+	case 1:
+		r.upper = &semver{major: numbers[0] + 1}
+	case 2:
+		r.upper = &semver{major: numbers[0], minor: numbers[1] + 1}
+	case 3:
+		r.lower.prerelease = match[4]
+	}
+	return r, nil
+}
+
+// contains reports whether v is in the range. For a full version, that
+// means v is that version.
+func (r semverRange) contains(v semver) bool {
+	if r.parts == 3 {
+		return v.compare(r.lower) == 0
+	}
+	return v.compare(r.lower) >= 0 && (r.upper == nil || v.compare(*r.upper) < 0)
+}
+
+// semverComparison is one part of a constraint, e.g. >=1.2.
+type semverComparison struct {
+	operator string
+	r        semverRange
+}
+
+func (c semverComparison) matches(v semver) bool {
+	// a prerelease only matches a constraint that mentions one, so ^1.2.0
+	// doesn't pick up 1.3.0-beta.1
+	if v.prerelease != "" && c.r.lower.prerelease == "" && c.operator != "!=" {
+		return false
+	}
+
+	switch c.operator {
+	case "", "=":
+		return c.r.contains(v)
+	case "!=":
+		return !c.r.contains(v)
+	case ">":
+		if c.r.parts == 3 {
+			return v.compare(c.r.lower) > 0
+		}
+		return c.r.upper != nil && v.compare(*c.r.upper) >= 0
+	case ">=":
+		return v.compare(c.r.lower) >= 0
+	case "<":
+		return v.compare(c.r.lower) < 0
+	case "<=":
+		if c.r.parts == 3 {
+			return v.compare(c.r.lower) <= 0
+		}
+		return c.r.upper == nil || v.compare(*c.r.upper) < 0
+	case "~":
+		// patch changes (or minor ones, if only the major is given)
+		upper := semver{major: c.r.lower.major, minor: c.r.lower.minor + 1}
+		if c.r.parts == 0 {
+			return true
+		} else if c.r.parts == 1 {
+			upper = semver{major: c.r.lower.major + 1}
+		}
+		return v.compare(c.r.lower) >= 0 && v.compare(upper) < 0
+	case "^":
+		// changes that don't modify the left-most non-zero part
+		var upper semver
+		switch {
+		case c.r.parts == 0:
+			return true
+		case c.r.lower.major > 0 || c.r.parts == 1:
+			upper = semver{major: c.r.lower.major + 1}
+		case c.r.lower.minor > 0 || c.r.parts == 2:
+			upper = semver{minor: c.r.lower.minor + 1}
+		default:
+			upper = semver{patch: c.r.lower.patch + 1}
+		}
+		return v.compare(c.r.lower) >= 0 && v.compare(upper) < 0
+	}
+	return false
+}
+
+var (
+	// semverOperatorRegexp matches the operator at the start of a
+	// comparison (=> and =< are accepted for >= and <=, ~> for ~)
+	semverOperatorRegexp = regexp.MustCompile(`^(!=|>=|=>|<=|=<|~>|[=><~^])?`)
+	// semverSpaceAfterOperatorRegexp removes spaces between an operator
+	// and its version, so >= 1.2 can be split on spaces
+	semverSpaceAfterOperatorRegexp = regexp.MustCompile(`(!=|>=|=>|<=|=<|~>|[=><~^])\s+`)
+	semverHyphenRegexp             = regexp.MustCompile(`^(\S+)\s+-\s+(\S+)$`)
+	semverOperatorAliases          = map[string]string{"=>": ">=", "=<": "<=", "~>": "~"}
+)
+
+// parseSemverConstraint parses constraints in the style of
+// github.com/Masterminds/semver: comparisons separated by commas or
+// spaces must all match, and groups of them separated by || are
+// alternatives. For example, ">=1.21.x, <2 || 3.0.0 - 3.2".
+func parseSemverConstraint(constraint string) ([][]semverComparison, error) {
+	var alternatives [][]semverComparison
+	for _, group := range strings.Split(constraint, "||") {
+		group = strings.TrimSpace(group)
+		if match := semverHyphenRegexp.FindStringSubmatch(group); match != nil {
+			// an inclusive range, e.g. 1.2 - 1.4.5
+			group = ">=" + match[1] + " <=" + match[2]
+		}
+
+		var comparisons []semverComparison
+		group = semverSpaceAfterOperatorRegexp.ReplaceAllString(group, "$1")
+		for _, field := range strings.FieldsFunc(group, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			operator := semverOperatorRegexp.FindString(field)
+			r, err := parseSemverRange(field[len(operator):])
+			if err != nil {
+				return nil, err
+			}
+			if alias, ok := semverOperatorAliases[operator]; ok {
+				operator = alias
+			}
+			comparisons = append(comparisons, semverComparison{operator: operator, r: r})
+		}
+		if len(comparisons) == 0 {
+			return nil, errors.New("empty constraint")
+		}
+		alternatives = append(alternatives, comparisons)
+	}
+	return alternatives, nil
+}
+
+func semverCompareBuiltin(constraint string, version string) (bool, error) {
+	alternatives, err := parseSemverConstraint(constraint)
+	if err != nil {
+		return false, fmt.Errorf("semverCompare: constraint %q: %s", constraint, err)
+	}
+	v, err := parseSemver(version)
+	if err != nil {
+		return false, fmt.Errorf("semverCompare: %s", err)
+	}
+
+	for _, comparisons := range alternatives {
+		matched := true
+		for _, c := range comparisons {
+			if !c.matches(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func semverParseBuiltin(version string) (map[string]interface{}, error) {
+	v, err := parseSemver(version)
+	if err != nil {
+		return nil, fmt.Errorf("semverParse: %s", err)
+	}
+	return map[string]interface{}{
+		"major":      float64(v.major),
+		"minor":      float64(v.minor),
+		"patch":      float64(v.patch),
+		"prerelease": v.prerelease,
+		"metadata":   v.metadata,
+	}, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// shellCommand runs a function's command line with the platform's shell
+// (for -exec-shell), so it can use builtins, pipes and paths with spaces.
+func shellCommand(commandLine string, args []string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		for _, arg := range args {
+			commandLine += " " + quoteCmdArg(arg)
+		}
+		return cmdShellCommand(commandLine)
+	}
+	// the arguments are passed to sh separately, so they don't need quoting
+	return exec.Command("sh", append([]string{"-c", commandLine + ` "$@"`, "sh"}, args...)...)
+}
+
+// cmdMetacharacters are the characters cmd.exe interprets itself.
+const cmdMetacharacters = `()%!^"<>&|`
+
+// quoteCmdArg quotes arg for a program run by cmd.exe: first so the
+// program's CommandLineToArgvW reads it back as arg, and then with ^
+// before anything cmd.exe would otherwise interpret.
+func quoteCmdArg(arg string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	backslashes := 0
+	for _, c := range arg {
+		switch c {
+		case '\\':
+			backslashes++
+		case '"':
+			// backslashes before a quote are escapes, so double them
+			// (plus one to escape the quote itself)
+			quoted.WriteString(strings.Repeat(`\`, backslashes+1))
+			backslashes = 0
+		default:
+			backslashes = 0
+		}
+		quoted.WriteRune(c)
+	}
+	// as must any before the closing quote
+	quoted.WriteString(strings.Repeat(`\`, backslashes))
+	quoted.WriteByte('"')
+
+	var escaped strings.Builder
+	for _, c := range quoted.String() {
+		if strings.ContainsRune(cmdMetacharacters, c) {
+			escaped.WriteByte('^')
+		}
+		escaped.WriteRune(c)
+	}
+	return escaped.String()
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "os/exec"
+
+// cmdShellCommand is only used on Windows (see shell_windows.go).
+func cmdShellCommand(commandLine string) *exec.Cmd {
+	return exec.Command("cmd.exe", "/S", "/C", commandLine)
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestQuoteCmdArg(t *testing.T) {
+	tests := []struct {
+		arg, expected string
+	}{
+		{``, `^"^"`},
+		{`plain`, `^"plain^"`},
+		{`with spaces`, `^"with spaces^"`},
+		{`say "hi"`, `^"say \^"hi\^"^"`},
+		{`a\"b`, `^"a\\\^"b^"`},
+		{`C:\dir\`, `^"C:\dir\\^"`},
+		{`C:\dir\\`, `^"C:\dir\\\\^"`},
+		{`a\b`, `^"a\b^"`},
+		{`100%`, `^"100^%^"`},
+		{`%PATH%`, `^"^%PATH^%^"`},
+		{`a^b&c|d`, `^"a^^b^&c^|d^"`},
+		{`<in> (x)!`, `^"^<in^> ^(x^)^!^"`},
+	}
+	for _, test := range tests {
+		if quoted := quoteCmdArg(test.arg); quoted != test.expected {
+			t.Errorf("quoteCmdArg(%s): got %s, expected %s", test.arg, quoted, test.expected)
+		}
+	}
+}
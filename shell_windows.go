@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// cmdShellCommand runs commandLine with cmd.exe. The command line is set
+// directly, since Go's quoting of exec.Command's arguments is for
+// CommandLineToArgvW, not cmd.exe.
+func cmdShellCommand(commandLine string) *exec.Cmd {
+	shell := os.Getenv("COMSPEC")
+	if shell == "" {
+		shell = "cmd.exe"
+	}
+	command := exec.Command(shell)
+	command.SysProcAttr = &syscall.SysProcAttr{CmdLine: `/S /C "` + commandLine + `"`}
+	return command
+}
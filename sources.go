@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// uriSource fetches the data for a scheme://resource context argument,
+// along with any metadata beyond the uri and basename (which may be nil).
+// Sources for cloud services are registered by files with build tags
+// (e.g. aws_sm.go), so their dependencies are only included on request.
+type uriSource struct {
+	description string
+	fetch       func(resource string) ([]byte, map[string]interface{}, error)
+}
+
+var uriSources = make(map[string]uriSource)
+
+var uriRegexp = regexp.MustCompile(`^([a-z][a-z0-9+.-]*)://(.+)$`)
+
+// uriBuildTags are the build tags needed for URI sources that aren't in
+// the default build, so that using one explains how to get it.
+var uriBuildTags = map[string]string{
+	"aws-sm": "aws",
+	"s3":     "aws",
+	"gs":     "gcp",
+}
+
+// bucketKeySchemes are the object storage schemes, whose resources are
+// checked to be bucket/key even by builds without them.
+var bucketKeySchemes = map[string]bool{
+	"s3": true,
+	"gs": true,
+}
+
+// lookupURISource returns the source for scheme, checking that resource
+// is the right shape for it.
+func lookupURISource(scheme string, resource string) (uriSource, error) {
+	if bucketKeySchemes[scheme] {
+		if _, _, err := splitBucketKey(resource); err != nil {
+			return uriSource{}, err
+		}
+	}
+	source, ok := uriSources[scheme]
+	if !ok {
+		if tag, ok := uriBuildTags[scheme]; ok {
+			return uriSource{}, fmt.Errorf("%s:// isn't supported by this build of rjsone (build with -tags %s)", scheme, tag)
+		}
+		return uriSource{}, fmt.Errorf("%s:// isn't supported by this build of rjsone (see -list-formats)", scheme)
+	}
+	return source, nil
+}
+
+// uriContent is context data from a uriSource.
+type uriContent struct {
+	format   inputFormat
+	scheme   string
+	resource string
+	opts     *loadOptions
+	// extra is the metadata from the source, once loaded
+	extra map[string]interface{}
+}
+
+func (uc *uriContent) uri() string {
+	return uc.scheme + "://" + uc.resource
+}
+
+func (uc *uriContent) load() (interface{}, error) {
+	source, err := lookupURISource(uc.scheme, uc.resource)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", uc.uri(), err)
+	}
+	data, extra, err := source.fetch(uc.resource)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", uc.uri(), err)
+	}
+	uc.extra = extra
+	result, err := loadBytes(uc.format, data, uc.opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", uc.uri(), err)
+	}
+	return result, nil
+}
+
+func (uc *uriContent) metadata() map[string]interface{} {
+	metadata := map[string]interface{}{
+		"uri":      uc.uri(),
+		"basename": path.Base(uc.resource),
+	}
+	for k, v := range uc.extra {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+// storeSource reads context data from a secret or parameter store, for
+// :format:path context arguments (where the path is in the store, rather
+// than a filename). Like uriSources, stores with large dependencies are
+// registered by files with build tags.
+type storeSource struct {
+	description string
+	load        func(path string) (interface{}, error)
+}
+
+var storeSources = make(map[inputFormat]storeSource)
+
+// storeBuildTags are the build tags needed for stores that aren't in the
+// default build, so that using one explains that rather than failing to
+// read the path as a file.
+var storeBuildTags = map[inputFormat]string{
+	"ssm": "aws",
+}
+
+func isStoreFormat(format inputFormat) bool {
+	_, registered := storeSources[format]
+	_, tagged := storeBuildTags[format]
+	return registered || tagged
+}
+
+// storeContent is context data from a storeSource.
+type storeContent struct {
+	format inputFormat
+	path   string
+}
+
+func (sc *storeContent) load() (interface{}, error) {
+	source, ok := storeSources[sc.format]
+	if !ok {
+		return nil, fmt.Errorf("%s:%s: %s isn't supported by this build of rjsone (build with -tags %s)", sc.format, sc.path, sc.format, storeBuildTags[sc.format])
+	}
+	result, err := source.load(sc.path)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s: %s", sc.format, sc.path, err)
+	}
+	return result, nil
+}
+
+func (sc *storeContent) metadata() map[string]interface{} {
+	return map[string]interface{}{
+		"store": string(sc.format),
+		"path":  sc.path,
+	}
+}
+
+// splitBucketKey splits the bucket/key resource of an object storage URI.
+func splitBucketKey(resource string) (string, string, error) {
+	parts := strings.SplitN(resource, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%q should be bucket/key", resource)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,11 @@
+#!/bin/sh
+
+rm -f out.yaml out.json
+rjsone -y -append -o out.yaml -t template.yaml num::+1
+rjsone -y -append -o out.yaml -t template.yaml num::+2
+rjsone -append -i 0 -o out.json -t template.yaml num::+3
+rjsone -append -i 0 -o out.json -t template.yaml num::+4
+cat out.yaml out.json
+rm -f out.yaml out.json
+rjsone -append -t template.yaml num::+5
+rjsone -append -diff -o out.yaml -t template.yaml num::+5
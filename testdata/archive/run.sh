@@ -0,0 +1,16 @@
+#!/bin/sh
+
+dir="$(mktemp -d)"
+trap 'rm -rf "$dir"' EXIT
+(cd bundle && tar -czf "$dir/bundle.tar.gz" * && zip -qr "$dir/bundle.zip" *)
+cd "$dir"
+
+rjsone -y -t +'{$eval: cfg}' cfg:bundle.tar.gz!configs/prod.yaml
+rjsone -y -t +'{$eval: cfg}' cfg:yaml:bundle.zip!configs/dev.yaml#/replicas
+rjsone -y -t +'{$eval: odd}' odd:bundle.zip!configs/odd\\!name.yaml
+rjsone -y -t +'{$eval: m}' m:... bundle.zip!manifests/*.yaml bundle.tar.gz!configs/dev.yaml
+rjsone -y -t bundle.tar.gz!template.yaml cfg:bundle.tar.gz!configs/prod.yaml
+rjsone -y -t +'{$eval: cfg}' cfg:bundle.zip!configs/prd.yaml
+rjsone -y -t +'{$eval: cfg}' cfg:bundle.zip!manifests/*.yaml
+rjsone -y -t +'{$eval: m}' m:.. bundle.zip!nothing/*.yaml
+rjsone -y -t +'{$eval: cfg}' cfg:bundle.rar!configs/prod.yaml
@@ -0,0 +1,8 @@
+#!/bin/sh
+
+rjsone -y -auto-format -t +'{$eval: "{notes: notes, env: env, data: data, other: other}"}' notes:notes.txt env:app.env data:data.json other:other.conf
+rjsone -y -t +'{$eval: notes}' notes:notes.txt
+rjsone -y -auto-format -t +'{$eval: notes}' notes:yaml:notes.txt
+rjsone -y -auto-format -t +'{$eval: files}' files:.. notes.txt data.json
+rjsone -y -auto-format -t +'{$eval: files}' files:yaml:.. notes.txt data.json
+rjsone -y -auto-format -t +'{$eval: notes}' notes:notes.txt#/name
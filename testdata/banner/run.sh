@@ -0,0 +1,10 @@
+#!/bin/sh
+
+rjsone -y -yaml-leading-separator -banner-file banner.txt -t template.yaml name::+foo
+# the banner is only written at the top of the file when appending
+trap 'rm -f out.yaml' EXIT
+rm -f out.yaml
+rjsone -y -append -banner 'Generated.' -o out.yaml -t template.yaml name::+one
+rjsone -y -append -banner 'Generated.' -o out.yaml -t template.yaml name::+two
+cat out.yaml
+rjsone -y -banner 'Generated.' -banner-file banner.txt -t template.yaml name::+foo
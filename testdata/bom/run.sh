@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -t template.yaml :json:bom.json bom.yaml kv:kv:bom.kv
+rjsone -t template.yaml latin1.yaml
+rjsone -t latin1.yaml
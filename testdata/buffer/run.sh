@@ -0,0 +1,10 @@
+#!/bin/sh
+
+echo old > output.yaml
+rjsone -y -t template.yaml -o output.yaml a::+1
+cat output.yaml
+rjsone -y -stream -t template.yaml a::+1
+rjsone -y -t template.yaml a::+1
+rjsone -buffer -stream -t template.yaml
+rjsone -y -buffer -t template.yaml a::+1
+rm output.yaml
@@ -0,0 +1,6 @@
+#!/bin/sh
+
+rjsone -y -t compute.yaml -chain format.yaml context.yaml
+rjsone -y -t multi.yaml -chain +'{count: {$eval: len(docs)}}' -chain-key docs
+rjsone -y -t compute.yaml -chain format.yaml -chain-key domain context.yaml
+rjsone -y -t compute.yaml -chain format.yaml -chain-key not-valid context.yaml
@@ -0,0 +1,14 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml
+rjsone -t +'{"$eval": "cidrHost(\"10.0.0.0/30\", 4)"}'
+rjsone -t +'{"$eval": "cidrHost(\"10.0.0.0/30\", -5)"}'
+rjsone -t +'{"$eval": "cidrHost(\"10.0.0.0/30\", 1.5)"}'
+rjsone -t +'{"$eval": "cidrSubnet(\"10.0.0.0/16\", 8, 256)"}'
+rjsone -t +'{"$eval": "cidrSubnet(\"10.0.0.0/16\", 17, 0)"}'
+rjsone -t +'{"$eval": "cidrHost(\"::ffff:10.0.0.0/104\", 1)"}'
+rjsone -t +'{"$eval": "cidrHost(\"::ffff:10.0.0.0/104\", 16777216)"}'
+rjsone -t +'{"$eval": "cidrSubnet(\"::ffff:10.0.0.0/104\", 8, 3)"}'
+rjsone -t +'{"$eval": "cidrContains(\"10.0.0.0\", \"10.0.0.1\")"}'
+rjsone -t +'{"$eval": "ipAdd(\"255.255.255.255\", 1)"}'
+rjsone -t +'{"$eval": "ipAdd(\"::\", -1)"}'
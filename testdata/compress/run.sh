@@ -0,0 +1,10 @@
+#!/bin/sh
+
+rjsone -t template.yaml -o out.json.gz
+gunzip -c out.json.gz
+rjsone -y -t template.yaml -o out.yaml.gz
+rjsone -y -append -t template.yaml -o out.yaml.gz
+gunzip -c out.yaml.gz
+rjsone -diff -t template.yaml -o out.json.gz && echo same
+rjsone -compress -t template.yaml | gunzip -c
+rm out.json.gz out.yaml.gz
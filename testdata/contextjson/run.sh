@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -y -context-json '{"name": "inline", "replicas": 1}' -t +'{$eval: "[name, replicas]"}'
+rjsone -y -context-json @context.json -t +'{$eval: image}' image.tag::+v2
+echo '{"fromStdin": true}' | rjsone -y -context-json @- -t +'{$eval: fromStdin}'
+rjsone -context-json '[1, 2]' -t +'{}'
+rjsone -context-json '{name: not json}' -t +'{}'
@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -context-prefix inputs -t template.yaml values.yaml extra:+1
+rjsone -context-prefix inputs -t +'${name}' values.yaml
+rjsone -context-prefix inputs.x -t template.yaml values.yaml
@@ -0,0 +1,10 @@
+#!/bin/sh
+# replies to each request with the request and how many calls there have been
+n=0
+while read -r request; do
+  n=$((n + 1))
+  case "$request" in
+    *fail*) echo '{"error": "asked to fail"}' ;;
+    *) echo "{\"result\": {\"call\": $n, \"request\": $request}}" ;;
+  esac
+done
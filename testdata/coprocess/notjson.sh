@@ -0,0 +1,5 @@
+#!/bin/sh
+# replies with something that is not JSON
+read -r request
+echo not json
+sleep 1
@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml lookup:-\&@echo.sh rawlookup::-\&./echo.sh
+rjsone -y -functions functions.yaml -t template.yaml rawlookup::-\&./echo.sh
+rjsone -y -t fail.yaml lookup:-\&@echo.sh
+rjsone -y -t fail.yaml lookup:-\&true
+rjsone -y -t fail.yaml lookup:-\&@notjson.sh
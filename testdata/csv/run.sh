@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -f csv -t template.yaml
+rjsone -f csv -t nested.yaml
+rjsone -f xml -t nested.yaml
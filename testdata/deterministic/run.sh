@@ -0,0 +1,12 @@
+#!/bin/sh
+
+COUNTER=$(mktemp)
+export COUNTER
+trap 'rm -f "$COUNTER"' EXIT
+
+rjsone -assert-deterministic -y -t template.yaml tick:-cat
+rjsone -assert-deterministic -y -t template.yaml tick:-@tick.sh
+rjsone -assert-deterministic -i 0 -t template.yaml tick:-@tick.sh
+rjsone -assert-deterministic -t +'{"a": 1}'
+echo 'a: 1' | rjsone -assert-deterministic -t +'{"$eval": "a"}' :-
+rjsone -assert-deterministic -t +'{}' -chain +'{}'
@@ -0,0 +1,6 @@
+#!/bin/sh
+# counts how many times it's been called
+n=$(cat "$COUNTER" 2>/dev/null || echo 0)
+n=$((n + 1))
+echo $n >"$COUNTER"
+echo $n
@@ -0,0 +1,10 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml -o output.yaml -diff b::+2 k::+11 || echo "exit $?"
+rjsone -y -t template.yaml -o output.yaml b::+2 k::+11
+rjsone -y -t template.yaml -o output.yaml -diff b::+2 k::+11 && echo same
+rjsone -y -t template.yaml -o output.yaml -diff b::+two k::+eleven || echo "exit $?"
+rjsone -y -t template.yaml -o output.yaml b::+2 k::+11
+printf '%s' "$(cat output.yaml)" > output.yaml
+rjsone -y -t template.yaml -o output.yaml -diff b::+2 k::+11 || echo "exit $?"
+rm output.yaml
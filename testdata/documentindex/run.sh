@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml
+# a context key of the same name wins
+rjsone -y -t +'{$eval: rjsone}' rjsone:+mine
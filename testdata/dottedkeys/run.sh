@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -t template.yaml base.yaml db.host::+localhost
+rjsone -t template.yaml base.yaml db.settings.debug:yaml:+true
+rjsone -t template.yaml base.yaml db.port:mergepatch:+6543
+rjsone -t ctx.yaml ctx:yaml:+'{}' 'ctx.a\.b::+literal'
+rjsone -t template.yaml base.yaml db.host.name::+oops
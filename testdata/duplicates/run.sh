@@ -0,0 +1,6 @@
+#!/bin/sh
+
+rjsone -y -v -t template.yaml context1.yaml extra:context1.yaml extra:context2.yaml foo::+override 2>&1 >/dev/null | grep Warning
+rjsone -y -collect-duplicates -t template.yaml context1.yaml extra:context1.yaml extra:context2.yaml
+# a key given once isn't collected into a list
+rjsone -y -collect-duplicates -t template.yaml context1.yaml extra:context2.yaml
@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -t template.yaml base.yaml empty.yaml whitespace.yaml separator.yaml null.yaml
+rjsone -t +'{$eval: "[e, w, s]"}' e:empty.yaml w:whitespace.yaml s:separator.yaml
+rjsone -t template.yaml list.yaml
+rjsone -t template.yaml +'just a string'
+rjsone -t template.yaml :json:+3
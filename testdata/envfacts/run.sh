@@ -0,0 +1,9 @@
+#!/bin/sh
+
+# the values differ between machines, so only check they're consistent
+# with the shell's
+rjsone -y -inject-env-facts -t template.yaml cwd::+"$PWD" host::+"$(hostname)" uid:+$(id -u)
+rjsone -y -inject-env-facts=env -t +'{$eval: typeof(env.os)}'
+rjsone -y -inject-env-facts -t +'{$eval: rjsone.os}' rjsone:+'{os: overridden}'
+rjsone -inject-env-facts=not-valid -t +'{}'
+rjsone -y -inject-env-facts -t +'{$eval: "[typeof(rjsone.os), rjsone.documentIndex, rjsone.documentCount]"}'
@@ -0,0 +1,4 @@
+#!/bin/sh
+
+rjsone -exec-parallelism 1 -t template.yaml up::--'tr a-z A-Z'
+rjsone -exec-parallelism -1 -t template.yaml up::--'tr a-z A-Z'
@@ -0,0 +1,4 @@
+#!/bin/sh
+
+rjsone -y -exec-shell -t template.yaml say::--'printf "[%s]"' shout::--'cat | tr a-z A-Z'
+rjsone -y -t split.yaml say::--'printf "[%s]"'
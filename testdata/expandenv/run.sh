@@ -0,0 +1,7 @@
+#!/bin/sh
+
+export RJSONE_TEST_HOME=/home/test
+unset RJSONE_TEST_USER
+rjsone -y -t template.yaml context.yaml
+rjsone -y -expand-env -t template.yaml context.yaml
+rjsone -y -expand-env-strict -t template.yaml context.yaml
@@ -0,0 +1,21 @@
+#!/bin/sh
+
+# none of these files exist, since nothing is loaded
+rjsone -explain -t missing.yaml \
+	missing.yaml :json:missing.json 'env+:missing.yaml#/spec' \
+	name::+world port:+8080 notes:: \
+	mylist:.. a.yaml :json:b.json : c.yaml \
+	files:text:... x.txt \
+	'k[case=snake,pick=a]:f.yaml@old=new' \
+	- fd:3 'z:bundle.zip!a.yaml' https://example.com/x.json \
+	c:json:-'cat x' 'd:-["echo", "a b"]' r:--date 'cp:-&coproc'
+rjsone -explain -git-context=optional -inject-env-facts -context-json @ctx.json
+rjsone -explain 'k[bad=option]:f.yaml'
+
+# the structured forms, which show how the grammar splits arguments
+rjsone -explain=yaml \
+	foo::+bar:baz 'db.host:+{port: 5432}' 'spec+:override.yaml' \
+	mylist:.. a.yaml : empty:.. : \
+	'r:raw.yaml|reshape.yaml@old=new'
+rjsone -explain=json 'k[case=camel]:json:-&serve' 'cp:-<cat'
+rjsone -explain=xml a.yaml
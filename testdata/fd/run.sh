@@ -0,0 +1,8 @@
+#!/bin/sh
+
+rjsone -y -t +'{$eval: "[data, rest]"}' data:json:fd:3 rest:fd:4 3<data.json 4<data.yaml
+printf 'a: 1\n' | rjsone -y -t +'{$eval: x}' x:fd:0
+rjsone -y -t +'{$eval: l}' l:... fd:3#/b 3<data.yaml
+rjsone -y -t +'{$eval: x}' x:fd:three
+rjsone -y -t +'{$eval: x}' x:fd:9
+rjsone -y -t +'{$eval: name}' fd:3 3<data.json
@@ -0,0 +1,11 @@
+#!/bin/sh
+
+rjsone -i -3 -t template.yaml
+rjsone -y -i 4 -t template.yaml
+rjsone -y -t template.yaml
+rjsone -o template.yaml -t template.yaml
+rjsone -o ./sub/../template.yaml -t "$PWD/template.yaml"
+rjsone -o template.yaml -t +'{}' -chain template.yaml
+rjsone -relative-to-template -o template.yaml -t ../flagvalidation/template.yaml
+rjsone -diff -o template.yaml -t template.yaml
+cat template.yaml
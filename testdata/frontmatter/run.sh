@@ -0,0 +1,10 @@
+#!/bin/sh
+
+rjsone -y -t +'{$eval: post}' post:frontmatter:article.md
+rjsone -y -t +'{$eval: post}' post:frontmatter:plain.md
+# the body can be dropped with a key option
+rjsone -y -t +'{$eval: post}' 'post[drop=content]:frontmatter:article.md'
+rjsone -y -auto-format -t +'{$eval: post.title}' post:article.md
+rjsone -y -t +'{$eval: post}' post:frontmatter:crlf.md
+rjsone -y -t +'{$eval: post}' post:frontmatter:unterminated.md
+rjsone -y -t +'{$eval: post}' post:frontmatter:list.md
@@ -0,0 +1,14 @@
+#!/bin/sh
+
+rjsone -y -relative-to-template -t site/templates/template.yaml
+rjsone -y -t +'{$eval: glob("site/*/*.yaml")}'
+rjsone -y -root site -t +'{$eval: glob("*.yaml")}'
+rjsone -y -root site -t +'{$eval: fileExists("secret.yaml")}'
+rjsone -y -root site -t +'{$eval: fileExists("missing.yaml")}'
+rjsone -y -root site -t +'{$eval: "[fileExists(\"site/data/a.yaml\"), fileExists(\"site/data/missing.yaml\")]"}'
+rjsone -y -root site -t +'{"$eval": "readFile(\"secret.yaml\", \"\")"}'
+rjsone -y -t +'{"$eval": "readFile(\"site/data/missing.yaml\", \"\")"}'
+rjsone -y -t +'{"$eval": "readFile(\"site/data/notes.txt\", \"json\")"}'
+rjsone -y -t +'{"$eval": "glob(\"[\")"}'
+rjsone -y -no-fs-builtins -t +'{$eval: glob("*")}'
+rjsone -y -t +'{$eval: glob}' glob::+shadowed
@@ -0,0 +1,4 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml echo::--'printf %s\n'
+rjsone -y -strict-function-args -t template.yaml echo::--'printf %s\n'
@@ -0,0 +1,11 @@
+#!/bin/sh
+
+# arguments with spaces and quotes aren't split or interpreted
+rjsone -y -t +'{$eval: "show([], \"\")"}' show::--'["printf", "[%s]\n", "a b", "it'"'"'s \"quoted\""]'
+rjsone -y -t +'{$eval: "echo([\"x y\"], \"\")"}' echo::--'["echo", "-n"]'
+# the argv is run directly, even with -exec-shell
+rjsone -exec-shell -y -t +'{$eval: "echo([], \"\")"}' echo::--'["echo", "$HOME | cat"]'
+# [ is still the test command
+rjsone -y -t +'{$eval: "check([], \"\").exitCode"}' check::---'[ -n x ]'
+rjsone -y -t +'{$eval: "f([], \"\")"}' f::--'["echo", 1]'
+rjsone -y -t +'{$eval: "f([], \"\")"}' f::--'[""]'
@@ -0,0 +1,8 @@
+#!/bin/sh
+
+export KEEP=kept OTHER=other SECRET_TOKEN=hunter2
+rjsone -y -t template.yaml showenv:-@showenv.sh
+rjsone -y -function-env-allowlist OTHER,KEEP -t template.yaml showenv:-@showenv.sh
+rjsone -y -function-env-allowlist OTHER -function-env-allowlist KEEP -t template.yaml showenv:-@showenv.sh
+rjsone -y -function-env-allowlist '' -t template.yaml showenv:-@showenv.sh
+rjsone -y -function-env-allowlist OTHER -functions functions.yaml -t template.yaml
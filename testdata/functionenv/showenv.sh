@@ -0,0 +1,2 @@
+#!/bin/sh
+echo "{keep: ${KEEP-unset}, secret: ${SECRET_TOKEN-unset}, other: ${OTHER-unset}, extra: ${EXTRA-unset}}"
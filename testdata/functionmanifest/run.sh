@@ -0,0 +1,6 @@
+#!/bin/sh
+
+rjsone -y -functions functions.yaml -t template.yaml
+rjsone -y -functions functions.yaml -t template.yaml upper::--'tr a-z x'
+rjsone -y -functions functions.yaml -t slow.yaml
+rjsone -y -functions bad.yaml -t template.yaml
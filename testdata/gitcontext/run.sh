@@ -0,0 +1,30 @@
+#!/bin/sh
+
+repo="$(mktemp -d)"
+trap 'rm -rf "$repo"' EXIT
+
+# a repository with fixed identities and dates, so the commit is the same
+# every time
+export HOME="$repo" GIT_CONFIG_NOSYSTEM=1
+export GIT_AUTHOR_NAME=test GIT_AUTHOR_EMAIL=test@example.com GIT_AUTHOR_DATE='2020-01-02T03:04:05Z'
+export GIT_COMMITTER_NAME=test GIT_COMMITTER_EMAIL=test@example.com GIT_COMMITTER_DATE='2020-01-02T03:04:05Z'
+
+template="$PWD/template.yaml"
+cd "$repo"
+rjsone -y -t "$template" -git-context=optional
+rjsone -y -t "$template" -git-context
+
+git init -q .
+git symbolic-ref HEAD refs/heads/main
+echo one > file.txt
+git add file.txt
+git commit -q -m one
+rjsone -y -t "$template" -git-context
+
+git tag v1.0.0
+echo two > file.txt
+rjsone -y -t "$template" -git-context git:+'{override: true}'
+
+git checkout -q --detach
+rjsone -y -t +'{$eval: meta}' -git-context=meta
+rjsone -y -t +'{$eval: meta}' -git-context=not-valid
@@ -0,0 +1,6 @@
+#!/bin/sh
+
+rjsone -go-template hosts.tmpl -t template.yaml context.yaml
+rjsone -go-template missing.tmpl -t template.yaml context.yaml
+rjsone -y -go-template hosts.tmpl -t template.yaml context.yaml
+rjsone -go-template nope.tmpl -t template.yaml context.yaml
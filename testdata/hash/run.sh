@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -enable-hash -t template.yaml context.yaml
+rjsone -enable-hash -t +'{$eval: sha256(config)}' :json:reordered.json
+printf '%s' '{"a":"<1>","b":2}' | sha256sum
+printf '%s' '"a"' | sha256sum
+rjsone -t +'{$eval: sha256(config)}' context.yaml
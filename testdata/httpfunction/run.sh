@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -t template.yaml
+rjsone -enable-http -t template.yaml
+rjsone -enable-http -t badheader.yaml
@@ -0,0 +1,8 @@
+#!/bin/sh
+
+unset NO_SUCH_TOKEN
+rjsone -http-header 'no colon' -t /dev/null
+rjsone -http-bearer-token-env NO_SUCH_TOKEN -t /dev/null
+TOKEN=x rjsone -http-bearer-token-env TOKEN -http-header 'Authorization: Basic eA==' -t /dev/null
+rjsone -http-retries -1 -t /dev/null
+rjsone -http-retries 1 -t /dev/null x:json:http://127.0.0.1:1/config.json
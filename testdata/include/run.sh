@@ -0,0 +1,9 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml context.yaml
+rjsone -y -t +'{$rjsone-include: lib/labels.yaml, extra: true}' name::+api
+rjsone -y -t lib/ports.yaml -output-template output.yaml name::+api ports:json:+'[1]'
+rjsone -y -t lib/cycle-a.yaml
+rjsone -y -t +'{$rjsone-include: [lib/labels.yaml]}'
+rjsone -y -t +'{$rjsone-include: lib/list.yaml, extra: true}'
+rjsone -y -root lib -t +'{$rjsone-include: context.yaml}'
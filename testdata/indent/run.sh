@@ -0,0 +1,10 @@
+#!/bin/sh
+
+rjsone -indent json=tab -t template.yaml
+rjsone -indent json=0 -t template.yaml
+rjsone -y -indent yaml=4 -indent json=tab -t template.yaml
+rjsone -y -indent yaml=2 -t template.yaml
+rjsone -i 4 -indent json=2 -t template.yaml
+rjsone -indent yaml=tab -t template.yaml
+rjsone -indent csv=2 -t template.yaml
+rjsone -indent json -t template.yaml
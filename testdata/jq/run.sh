@@ -0,0 +1,6 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml config.yaml
+rjsone -t +'{$eval: "jq(\".services[]\", services)"}' services:config.yaml
+rjsone -t +'{$eval: "jq(\".[\", services)"}' services:config.yaml
+rjsone -t +'{$eval: "jq(\".services | error\", services)"}' services:config.yaml
@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml base.yaml labels+:yaml:more-labels.yaml overlay.yaml
+rjsone -y -t template.yaml base.yaml labels+:more-labels.yaml annotations+:yaml:+'{z: "3"}'
+rjsone -y -t template.yaml 'labels+:..' more-labels.yaml
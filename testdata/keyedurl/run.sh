@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -explain cfg:https://example.com/a.yaml cfg:json:https://example.com/a.json
+rjsone -explain=yaml cfg:https://example.com/a.yaml
+rjsone -t /dev/null cfg:http://127.0.0.1:1/a.yaml
@@ -0,0 +1,9 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml '[case=lower,prefix=aws_,drop=SECRET_ACCESS_KEY]:kv:aws.env' 'server[case=camel,recursive]:nested.yaml'
+rjsone -y -t template.yaml '[case=lower]:clash.yaml'
+rjsone -y -t rename.yaml :yaml:third.yaml@hostName=host@portNumber=port
+rjsone -y -t rename.yaml third.yaml@hostname=host
+# \@ is an @ in the filename, rather than the start of a rename
+rjsone -y -t +'{$eval: v}' 'config\@v=2.yaml'
+rjsone -y -t +'{$eval: version}' 'config\@v=2.yaml@v=version'
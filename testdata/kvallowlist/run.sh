@@ -0,0 +1,10 @@
+#!/bin/sh
+
+rjsone -y -kv-allowlist allowed.txt -t +'{$eval: env}' env:'kv\n=':good.env
+rjsone -y -kv-allowlist allowed.txt -auto-format -t +'{$eval: env}' env:good.env
+rjsone -y -kv-allowlist allowed.txt -t +'{$eval: env}' env:'kv\n=':bad.env
+rjsone -y -kv-allowlist allowed.txt -t +'{$eval: env}' env:kv:+'PORT 80'
+rjsone -y -kv-allowlist allowed.txt -t +'{$eval: env}' env:kv:+'port 80'
+# only kv contexts are checked
+rjsone -y -kv-allowlist allowed.txt -t +'{$eval: env}' env:+'{other: 1}'
+rjsone -y -kv-allowlist missing.txt -t +'{}'
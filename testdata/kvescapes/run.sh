@@ -0,0 +1,8 @@
+#!/bin/sh
+
+# each case: a kv file and what it parses to
+rjsone -t +'{$eval: kv}' kv:kv:unicode.kv
+rjsone -kv-escapes -t +'{$eval: kv}' kv:kv:escapes.kv
+rjsone -kv-escapes -t +'{$eval: kv}' 'kv:kv;=:separators.kv'
+rjsone -t +'{$eval: kv}' kv:kv:noescapes.kv
+rjsone -kv-escapes -t +'{$eval: kv}' kv:kv:unknown.kv
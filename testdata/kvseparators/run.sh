@@ -0,0 +1,3 @@
+#!/bin/sh
+
+exec rjsone -y -t records.yaml ':kv;=:records.kv' ':kv\0\t:nul.kv'
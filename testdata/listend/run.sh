@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml list:.. context1.yaml : context2.yaml other:+1
+rjsone -y -t template.yaml list:.. context1.yaml other:+1 context2.yaml
+rjsone -y -t template.yaml context2.yaml : other:+1
+rjsone -y -t nested.yaml cluster.apps:.. context1.yaml cluster.deps:... context2.yaml cluster.apps:.. context2.yaml
+rjsone -y -t nested.yaml cluster.apps:.. context1.yaml cluster.apps:... context2.yaml
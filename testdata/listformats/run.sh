@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -list-formats
+rjsone -f toml -t /dev/null
+rjsone -t /dev/null :toml:+x
@@ -0,0 +1,12 @@
+#!/bin/sh
+
+dir="$(mktemp -d)"
+trap 'rm -rf "$dir"' EXIT
+
+rjsone -y -t template.yaml -o "$dir/out.yaml" -manifest "$dir/manifest.json" a:+1
+sed "s|$dir|DIR|" "$dir/manifest.json"
+rjsone -y -t template.yaml -o "$dir/out.yaml" -manifest "$dir/manifest.json" -manifest-hashes -append a:+2
+sed "s|$dir|DIR|" "$dir/manifest.json"
+rjsone -y -t template.yaml -manifest "$dir/manifest.json" a:+1
+rjsone -y -t template.yaml -o out.yaml -manifest ./out.yaml a:+1
+rjsone -y -t template.yaml -o "$dir/out.yaml" -manifest-hashes a:+1
@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -y -max-depth 5 -t template.yaml deep.yaml
+rjsone -y -max-depth 4 -t template.yaml deep.yaml
+rjsone -y -max-depth 2 -t template.yaml wide.yaml
@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml context.yaml
+# deepMerge in a template agrees with -d
+rjsone -y -d -t +'{$eval: a}' a:context.yaml#/defaults a:context.yaml#/overrides
+rjsone -t +'{$eval: "merge({a: 1}, [2])"}'
+rjsone -t +'{$eval: "jsonPatch({a: 1}, [{op: \"remove\", path: \"/b\"}])"}'
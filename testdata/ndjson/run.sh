@@ -0,0 +1,6 @@
+#!/bin/sh
+
+rjsone -t +'{$eval: events}' events:ndjson:events.jsonl
+rjsone -auto-format -t +'{$eval: "len(events)"}' events:events.jsonl
+rjsone -t +'{$eval: events}' events:ndjson:bad.jsonl
+rjsone -t +'{$eval: events}' events:ndjson:+
@@ -0,0 +1,10 @@
+#!/bin/sh
+
+# the default build has neither, but still checks for bucket/key
+rjsone -t /dev/null cfg:json:s3://configs/prod/env.json
+rjsone -t /dev/null cfg:json:gs://configs/prod/env.json
+rjsone -t s3://configs/template.yaml
+rjsone -t /dev/null s3://configs
+rjsone -t /dev/null gs://configs/
+rjsone -t /dev/null cfg:s3:///env.json
+rjsone -t gs://configs
@@ -0,0 +1,6 @@
+#!/bin/sh
+
+rjsone -y -on-render-error skip -t template.yaml
+rjsone -y -v -on-render-error skip -t template.yaml 2>&1 >/dev/null | grep '^Skipping\|^Warning'
+rjsone -y -t template.yaml
+rjsone -on-render-error ignore -t template.yaml
@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -i 0 -max-output-bytes 2000 -t template.yaml items:yaml:+"[$(seq -s, 1 100)]" | wc -c | tr -d ' '
+rjsone -i 0 -max-output-bytes 500 -t template.yaml items:yaml:+"[$(seq -s, 1 100)]"
+rjsone -y -max-depth 4 -t deep.yaml deep:yaml:+'{d: 1}'
+rjsone -y -max-depth 4 -t deep.yaml deep:yaml:+'{d: {e: 1}}'
+rjsone -y -max-depth 2 -t deep.yaml x.y.z::+hi
@@ -0,0 +1,4 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml -output-template envelope.yaml namespace::+prod
+rjsone -y -t template.yaml -output-template envelope.yaml namespace::+prod doc::+mine
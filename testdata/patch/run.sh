@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml context.yaml :jsonpatch:fix.yaml labels:mergepatch:merge.yaml
+rjsone -y -t template.yaml context.yaml :jsonpatch:+'[{"op": "test", "path": "/name", "value": "bar"}]'
+# an empty path is the whole document
+rjsone -y -t +'{$eval: doc}' doc:+'{a: 1}' doc:jsonpatch:+'[{"op": "replace", "path": "", "value": {"b": 2}}]'
+rjsone -y -t +'{$eval: doc}' doc:+'{a: 1}' doc:jsonpatch:+'[{"op": "add", "path": "", "value": [3]}]'
@@ -0,0 +1,6 @@
+package main
+
+// Register tries to add a function that isn't a valid identifier.
+func Register(register func(name string, fn interface{}) error) error {
+	return register("not-valid", func() string { return "" })
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+// Register adds greet with the register function it's given.
+func Register(register func(name string, fn interface{}) error) error {
+	return register("greet", func(name string) string {
+		return fmt.Sprintf("hello, %s", name)
+	})
+}
@@ -0,0 +1,4 @@
+package main
+
+// Greeting is exported, but there's no Register.
+var Greeting = "hello"
@@ -0,0 +1,12 @@
+#!/bin/sh
+
+trap 'rm -rf build' EXIT
+
+for plugin in greet shout noregister badname; do
+  go build -buildmode=plugin -o build/$plugin.so ./$plugin || exit 1
+done
+
+rjsone -y -plugin build/greet.so -plugin build/shout.so -t template.yaml
+rjsone -y -plugin build/greet.so -plugin build/shout.so -t template.yaml greet:+hi
+rjsone -y -plugin build/noregister.so -t template.yaml
+rjsone -y -plugin build/badname.so -t template.yaml
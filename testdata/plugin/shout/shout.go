@@ -0,0 +1,14 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/wryun/rjsone/ext"
+)
+
+// Register adds shout by calling ext.RegisterFunction directly.
+func Register(register func(name string, fn interface{}) error) error {
+	return ext.RegisterFunction("shout", func(s string) string {
+		return strings.ToUpper(s) + "!"
+	})
+}
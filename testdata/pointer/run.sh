@@ -0,0 +1,4 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml image:ctx.yaml#/spec/template/image port:ctx.yaml#/spec/template/ports/1 odd:'odd\#name.yaml#/spec/template/image'
+rjsone -y -t template.yaml image:ctx.yaml#/spec/tmpl/image
@@ -0,0 +1,9 @@
+#!/bin/sh
+
+rjsone -pretty-errors -t template.yaml name::+web production::+true
+rjsone -pretty-errors -t interpolate.yaml name::+web count::+2
+rjsone -pretty-errors -t +'a: 1
+---
+b: ${nope}'
+rjsone -pretty-errors -t +'[1, {$if: 1, then: 2, thenn: 3}]'
+rjsone -t template.yaml name::+web production::+true
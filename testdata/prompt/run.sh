@@ -0,0 +1,7 @@
+#!/bin/sh
+
+# stderr isn't a terminal here, so only the defaults are used
+rjsone -y -prompt -prompt-default replicas=3 -prompt-default 'name=web' -prompt-default 'labels={a: b}' -t template.yaml given:+1
+rjsone -y -prompt-default replicas=3 -prompt-default 'name=web' -t template.yaml given:+1
+rjsone -y -prompt -t +'{$eval: missing}'
+rjsone -y -prompt-default 'bad' -t template.yaml
@@ -0,0 +1,3 @@
+#!/bin/sh
+
+exec rjsone -y -t template.yaml cfg:prototext:config.textpb
@@ -0,0 +1,18 @@
+#!/bin/sh
+
+rjsone -query /metadata/name -t template.yaml name::+web
+rjsone -y -query metadata -t template.yaml name::+web
+rjsone -query spec.containers.1.image -t template.yaml name::+web
+rjsone -query '/metadata/labels/app.kubernetes.io~1name' -t template.yaml name::+web
+rjsone -query 'metadata.labels.app\.kubernetes\.io/name' -t template.yaml name::+web
+rjsone -query /metadata/namespace -t template.yaml name::+web
+rjsone -query spec.containers.2 -t template.yaml name::+web
+rjsone -query metadata.name.first -t template.yaml name::+web
+rjsone -r -query metadata.name -t template.yaml name::+web
+rjsone -r -query metadata.labels -t template.yaml name::+web
+rjsone -r -y -query metadata.name -t template.yaml name::+web
+rjsone -r -query '.spec.containers[].image' -t template.yaml name::+web
+rjsone -query '.metadata.labels | keys' -t template.yaml name::+web
+rjsone -query '.spec.containers[] | select(.image == "none")' -t template.yaml name::+web
+rjsone -query '.metadata | .name +' -t template.yaml name::+web
+rjsone -query '.metadata.name | error("no \(.)")' -t template.yaml name::+web
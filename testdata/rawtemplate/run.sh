@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -t '+{"a": {"$eval": "x"}}' x::+hello
+rjsone -y -t '+[{$eval: x}, {$eval: x}]' x::+hello
+rjsone -t '+{"a": ' x::+hello
+rjsone -t http://127.0.0.1:1/template.yaml x::+hello
+rjsone -relative-to-template -t '+{}'
@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -base-dir data -t template.yaml env::+prod
+rjsone -base-dir data -t +'{$eval: "readData(\"../secret.yaml\", \"\")"}'
+rjsone -base-dir data -t +'{$eval: "readData(\"prod/missing.yaml\", \"\")"}'
+rjsone -base-dir data -t +'{$eval: "readData(\"prod/config.yaml\", \"nope\")"}'
+rjsone -t +'{$eval: "readData(\"prod/config.yaml\", \"\")"}'
@@ -0,0 +1,6 @@
+#!/bin/sh
+
+rjsone -y -relative-to-template -t sub/template.yaml -o output.yaml context1.yaml context2.yaml
+cat sub/output.yaml
+rm sub/output.yaml
+rjsone -relative-to-template context1.yaml < sub/template.yaml
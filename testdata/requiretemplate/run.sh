@@ -0,0 +1,9 @@
+#!/bin/sh
+
+printf '' | rjsone -t -
+printf '' | rjsone -require-template -t -
+printf '  \n\n# only a comment\n' | rjsone -require-template -t -
+# an explicitly empty document is still a document
+printf -- '---\n' | rjsone -require-template -t -
+printf 'a: 1\n' | rjsone -require-template -t -
+rjsone -require-template -t +'{}' -chain +''
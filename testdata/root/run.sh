@@ -0,0 +1,8 @@
+#!/bin/sh
+
+ln -s ../outside.yaml inside/link.yaml
+rjsone -y -root inside -t template.yaml inside/context1.yaml bar::+ok
+rjsone -y -root inside -t template.yaml inside/context1.yaml inside/../outside.yaml
+rjsone -y -root inside -t template.yaml inside/context1.yaml inside/link.yaml
+rjsone -y -root inside -t template.yaml inside/context1.yaml /etc/passwd
+rm inside/link.yaml
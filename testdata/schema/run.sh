@@ -0,0 +1,8 @@
+#!/bin/sh
+
+rjsone -enable-schema -t template.yaml schemas:schemas.yaml rawConfig:good.yaml
+rjsone -enable-schema -t template.yaml schemas:schemas.yaml rawConfig:bad.yaml
+rjsone -enable-schema -t template.yaml schemas:schemas.yaml rawConfig:missing.yaml
+rjsone -enable-schema -t +'{$eval: "validateSchema({type: 3}, 1)"}'
+rjsone -enable-schema -t +'{$eval: "validateSchema({\"$ref\": \"#\"}, 1)"}'
+rjsone -enable-schema -t +'{$eval: "validateSchema({not: {type: \"string\"}, anyOf: [{minimum: 5}, {multipleOf: 2}]}, 3)"}'
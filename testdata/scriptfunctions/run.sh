@@ -0,0 +1,7 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml lookup:-@scripts/lookup.sh
+rjsone -y -t ../scriptfunctions/template.yaml -relative-to-template lookup:-@scripts/lookup.sh
+rjsone -y -t listtemplate.yaml fns:... -@scripts/lookup.sh
+rjsone -y -t template.yaml lookup:-@scripts/missing.sh
+rjsone -y -t template.yaml lookup:-@scripts/notexec.sh
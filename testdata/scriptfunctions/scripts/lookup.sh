@@ -0,0 +1,4 @@
+#!/bin/sh
+# prints its arguments as a YAML object, ignoring stdin
+echo "name: $1"
+echo "region: $2"
@@ -0,0 +1,10 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml
+rjsone -t +'{$eval: semverParse("v1.22.3-rc.1+build.7")}'
+rjsone -t +'{$eval: semverParse("2")}'
+rjsone -t +'{$eval: semverParse("1.x")}'
+rjsone -t +'{"$eval": "semverCompare(\">=banana\", \"1.0.0\")"}'
+rjsone -t +'{"$eval": "semverCompare(\">=1.0\", \"1.0.0.0\")"}'
+rjsone -no-builtins -t +'{$eval: semverParse("1.0.0")}'
+rjsone -t +'{$eval: semverParse}' semverParse::+shadowed
@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -t /dev/null secret:json:aws-sm://my/secret
+rjsone -t /dev/null aws-sm://my/secret
+rjsone -t /dev/null params:ssm:/myapp/prod/
@@ -0,0 +1,20 @@
+#!/bin/sh
+
+trap 'rm -rf generated' EXIT
+mkdir -p generated
+
+rjsone -split-items -t template.json prefix::+json
+rjsone -y -split-items -t template.yaml prefix::+yaml
+printf '\357\273\277 [1, 2]' | rjsone -split-items -t -
+printf '\357\273\277 [1, 2]' > generated/bom.json
+rjsone -split-items -t generated/bom.json
+rjsone -split-items -t +'{not: a list}'
+printf -- '- 1\n---\n- 2\n' | rjsone -split-items -t -
+rjsone -split-items -t flow.yaml
+printf '[{name: a}]' | rjsone -split-items -t -
+printf '[1, 2] [3]' | rjsone -split-items -t -
+rjsone -split-items -t more.json
+rjsone -split-items -t truncated.json
+printf '["a", "\377"]' > generated/invalid.json
+rjsone -split-items -t generated/invalid.json
+printf '["a", "\377"]' | rjsone -split-items -t -
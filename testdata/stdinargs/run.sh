@@ -0,0 +1,6 @@
+#!/bin/sh
+
+printf 'context1.yaml\n\n  context2.yaml\n' | rjsone -y -t template.yaml @-
+printf 'context1.yaml\n' | rjsone -y @- < template.yaml
+rjsone -y -t template.yaml @args.txt
+rjsone -y -t template.yaml @nested.txt
@@ -0,0 +1,3 @@
+#!/bin/sh
+echo "connecting to server..."
+echo "[1, 2]"
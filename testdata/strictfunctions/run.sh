@@ -0,0 +1,8 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml f:-@noisy.sh
+rjsone -y -t template.yaml f:json:-@clean.sh
+rjsone -y -strict-functions -t template.yaml f:json:-@clean.sh
+rjsone -y -strict-functions -t template.yaml f:-@yaml.sh
+rjsone -y -strict-functions -t template.yaml f:json:-@yaml.sh
+rjsone -y -strict-functions -t template.yaml f:-@noisy.sh
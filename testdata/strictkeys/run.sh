@@ -0,0 +1,4 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml context.yaml
+rjsone -y -strict-keys -t template.yaml context.yaml
@@ -0,0 +1,3 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml context.yaml
@@ -0,0 +1,10 @@
+#!/bin/sh
+
+for n in 1 2; do
+  rjsone -y -tee -append -o log.yaml -t template.yaml n::+$n | sed 's/^/piped: /'
+done
+cat log.yaml
+rjsone -y -tee -o log.yaml.gz -t template.yaml n::+3
+gunzip -c log.yaml.gz
+rjsone -tee -t template.yaml n::+4
+rm log.yaml log.yaml.gz
@@ -0,0 +1,9 @@
+#!/bin/sh
+
+rjsone -y -text-extensions .sh,pem -t +'{$eval: files}' files:.. deploy.sh ca.PEM config.yaml
+# an explicit format, including one given to a list, wins
+rjsone -y -text-extensions sh -t +'{$eval: files}' files:yaml:.. deploy.sh
+rjsone -y -text-extensions sh -auto-format -t +'{$eval: "[script, config]"}' script:deploy.sh config:config.yaml
+rjsone -y -text-extensions sh,pem -base-dir . -t +'{"$eval": "readData(\"ca.PEM\", \"\")"}'
+rjsone -y -t +'{$eval: script}' script:deploy.sh
+rjsone -text-extensions .sh,,.pem -t +'{}'
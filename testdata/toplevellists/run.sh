@@ -0,0 +1,6 @@
+#!/bin/sh
+
+rjsone -merge-lists-at-top-level items -t template.yaml a.yaml b.yaml
+rjsone -merge-lists-at-top-level services -t +'{$eval: "services[-1]"}' b.yaml a.yaml
+rjsone -merge-lists-at-top-level items -t template.yaml object.yaml a.yaml
+rjsone -t template.yaml a.yaml
@@ -0,0 +1,3 @@
+#!/bin/sh
+
+rjsone -y -trace -trace-limit 60 -t template.yaml name::+world long::+0123456789012345678901234567890123456789012345678901234567890123456789
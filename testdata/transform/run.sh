@@ -0,0 +1,17 @@
+#!/bin/sh
+
+rjsone -y -t +'{$eval: data}' 'data:yaml:raw.yaml|byname.yaml'
+# transforms chain, and run before renames
+rjsone -y -t +'{$eval: data}' 'data:raw.yaml|byname.yaml|wrap.yaml@ports=servicePorts'
+rjsone -y -t +'{$eval: "[web, db, Owner]"}' 'raw.yaml|byname.yaml' raw.yaml
+rjsone -explain 'data:raw.yaml|byname.yaml'
+rjsone -y -t +'{$eval: data}' 'data:raw.yaml|'
+rjsone -y -t +'{$eval: data}' 'data:raw.yaml|broken.yaml'
+rjsone -y -t +'{$eval: data}' 'data:raw.yaml|missing.yaml'
+# transform templates are confined to -root like context files
+rjsone -y -root confined -t +'{$eval: data}' 'data:confined/raw.yaml|confined/names.yaml'
+rjsone -y -root confined -t +'{$eval: data}' 'data:confined/raw.yaml|byname.yaml'
+# \| is a | in a filename
+trap 'rm -f "raw|copy.yaml"' EXIT
+cp raw.yaml 'raw|copy.yaml'
+rjsone -y -t +'{$eval: data}' 'data:raw\|copy.yaml|byname.yaml'
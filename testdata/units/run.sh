@@ -0,0 +1,10 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml
+rjsone -t +'{$eval: parseDuration("5 minutes")}'
+rjsone -t +'{$eval: parseSize("12Q")}'
+rjsone -t +'{$eval: parseSize("-1Mi")}'
+rjsone -t +'{$eval: parseSize("1m")}'
+rjsone -t +'{$eval: formatDuration(1000000000000)}'
+rjsone -t +'{"$eval": "formatSize(1024, \"binary\")"}'
+rjsone -t +'{"$eval": "formatSize(-1, \"si\")"}'
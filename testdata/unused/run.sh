@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -y -v -t template.yaml context.yaml 2>&1 >/dev/null | grep Unused
+rjsone -y -warn-unused-context -t template.yaml context.yaml 2>&1 >/dev/null
+rjsone -y -strict-unused -t template.yaml context.yaml
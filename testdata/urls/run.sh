@@ -0,0 +1,5 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml
+rjsone -t +'{$eval: urlDecode("50%")}'
+rjsone -t +'{"$eval": "urlParse(\"http://[::1\")"}'
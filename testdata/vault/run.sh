@@ -0,0 +1,6 @@
+#!/bin/sh
+
+unset VAULT_ADDR VAULT_TOKEN VAULT_NAMESPACE
+rjsone -t /dev/null db:vault:secret/data/prod/db
+VAULT_ADDR=http://127.0.0.1:1 rjsone -t /dev/null db:vault:secret/data/prod/db
+VAULT_ADDR=http://127.0.0.1:1 VAULT_TOKEN=s.do-not-print rjsone -v -t /dev/null db:vault:secret/data/prod/db
@@ -0,0 +1,10 @@
+#!/bin/sh
+
+# only the first line is predictable, since the rest depends on the build
+rjsone -version | head -n 1
+
+# with the linker flags a release build is given, every line is
+trap 'rm -rf build' EXIT
+(cd ../.. && go build -buildvcs=false -o testdata/version/build/rjsone \
+  -ldflags "-X main.version=1.2.3 -X main.commit=0123abc -X main.date=2020-01-02T03:04:05Z") || exit 1
+build/rjsone -version
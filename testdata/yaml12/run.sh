@@ -0,0 +1,10 @@
+#!/bin/sh
+
+rjsone -y -t template.yaml values:context.yaml
+rjsone -y -yaml-1.1 -t template.yaml values:context.yaml
+rjsone -y -t +'{$eval: x}' x:+'{a: 1, a: 2}'
+rjsone -y -t +'{$eval: x}' x:+'.inf'
+rjsone -y -t +'{$eval: x}' x:+'!!str 0644'
+rjsone -y -t +'{$eval: x}' x:+'!Ref 0644'
+# aliases can't expand without limit (a "billion laughs")
+rjsone -y -t +'{$eval: x.a}' x:laughs.yaml
@@ -0,0 +1,11 @@
+#!/bin/sh
+
+rjsone -t +'{$eval: x}' x:ports.yaml
+rjsone -yaml-1.1 -t +'{$eval: x}' x:ports.yaml
+rjsone -t +'{$eval: x}' x:nullkey.yaml
+rjsone -yaml-1.1 -t +'{$eval: x}' x:nullkey.yaml
+rjsone -t +'{$eval: x}' x:listkey.yaml
+rjsone -yaml-1.1 -t +'{$eval: x}' x:listkey.yaml
+# templates are converted the same way
+rjsone -t +'{80: {$eval: "1 + 1"}}'
+rjsone -t +'{null: 1}'
@@ -0,0 +1,13 @@
+#!/bin/sh
+
+# tags are ignored by default
+rjsone -y -t template.yaml value:config.yaml
+rjsone -y -yaml-tags include -text-extensions txt -t template.yaml value:config.yaml
+rjsone -y -yaml-tags cloudformation -t template.yaml value:stack.yaml
+rjsone -y -yaml-tags include,cloudformation -t template.yaml value:yaml:+'!include db.yaml'
+rjsone -y -yaml-tags include -t template.yaml value:loop.yaml
+rjsone -y -yaml-tags include -t template.yaml value:yaml:+'!include [db.yaml]'
+rjsone -y -yaml-tags include -root . -t template.yaml value:yaml:+'!include ../basic/context1.yaml'
+rjsone -y -yaml-tags cloudformation -t template.yaml value:yaml:+'!GetAtt Bucket'
+rjsone -yaml-tags vault -t +'{}'
+rjsone -yaml-tags include -yaml-1.1 -t +'{}'
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// tracer prints each document's template, the context keys it can see
+// and its result to stderr (-trace).
+type tracer struct {
+	l *log.Logger
+	// limit is the maximum number of bytes of each value to show
+	limit int
+}
+
+func (t *tracer) template(document int, template interface{}, context map[string]interface{}) {
+	t.l.Printf("=== document %d: template ===\n%s\n", document, t.format(template))
+	var keys []string
+	for _, k := range sortedKeys(context) {
+		// like json-e's own, rjsone's builtins aren't listed
+		if !isBuiltin(k, context[k]) {
+			keys = append(keys, k)
+		}
+	}
+	t.l.Printf("=== document %d: context keys ===\n%s\n", document, strings.Join(keys, ", "))
+}
+
+func (t *tracer) result(document int, result interface{}) {
+	t.l.Printf("=== document %d: result ===\n%s\n", document, t.format(result))
+}
+
+// format returns v as indented JSON, truncated to the limit.
+func (t *tracer) format(v interface{}) string {
+	var s string
+	if encoded, err := json.MarshalIndent(v, "", "  "); err == nil {
+		s = string(encoded)
+	} else {
+		s = fmt.Sprintf("%v", v)
+	}
+
+	if t.limit > 0 && len(s) > t.limit {
+		truncated := truncateString(s, t.limit)
+		return fmt.Sprintf("%s... (%d more bytes; see -trace-limit)", truncated, len(s)-len(truncated))
+	}
+	return s
+}
+
+// truncateString returns at most limit bytes of s, without splitting a
+// UTF-8 character.
+func truncateString(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	end := limit
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
+
+// previewLimit is how much of a value preview shows.
+const previewLimit = 40
+
+// preview returns the start of v as compact JSON, for error messages that
+// shouldn't dump a whole file.
+func preview(v interface{}) string {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	if len(encoded) > previewLimit {
+		return truncateString(string(encoded), previewLimit) + "..."
+	}
+	return string(encoded)
+}
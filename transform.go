@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	jsone "github.com/taskcluster/json-e"
+
+	"github.com/wryun/rjsone/ext"
+)
+
+// transformKey is what a context's value is called in its transform
+// templates.
+const transformKey = "value"
+
+// splitTransforms removes any |template suffixes from the content part of
+// a context argument (e.g. raw.yaml|reshape.yaml), returning the
+// templates, which are resolved like context files, and unescaping any
+// \| in the rest. As with renames, raw text and functions can't have
+// them, since | is likely to be part of the text or command.
+func splitTransforms(rawContent string, opts *loadOptions) (string, []string, error) {
+	if _, data := parseFormat(rawContent); strings.HasPrefix(data, "+") || strings.HasPrefix(data, "-") && data != "-" {
+		return rawContent, nil, nil
+	}
+
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(rawContent); i++ {
+		switch {
+		case strings.HasPrefix(rawContent[i:], `\|`):
+			part.WriteByte('|')
+			i++
+		case rawContent[i] == '|':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(rawContent[i])
+		}
+	}
+	parts = append(parts, part.String())
+
+	var transforms []string
+	for _, filename := range parts[1:] {
+		if filename == "" {
+			return "", nil, errors.New("| should be followed by a transform template")
+		}
+		transforms = append(transforms, opts.resolve(filename))
+	}
+	return parts[0], transforms, nil
+}
+
+// applyTransform renders the transform template in filename with value
+// (as transformKey) and the registered functions, returning the result.
+// Like context files, transform templates must be inside -root.
+func applyTransform(filename string, value interface{}, opts *loadOptions) (interface{}, error) {
+	confined, err := opts.confine(filename)
+	if err != nil {
+		return nil, fmt.Errorf("transform %s: %s", filename, err)
+	}
+	template, err := loadTemplateFile(confined, opts)
+	if err != nil {
+		return nil, fmt.Errorf("transform %s: %s", filename, err)
+	}
+
+	names := ext.Functions()
+	context := make(map[string]interface{}, len(names)+1)
+	for _, name := range names {
+		context[name], _ = ext.Function(name)
+	}
+	context[transformKey] = value
+
+	result, err := jsone.Render(template, context)
+	if err != nil {
+		return nil, fmt.Errorf("transform %s: %s", filename, err)
+	}
+	return result, nil
+}
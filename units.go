@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	builtins["parseDuration"] = parseDurationBuiltin
+	builtins["formatDuration"] = formatDurationBuiltin
+	builtins["parseSize"] = parseSizeBuiltin
+	builtins["formatSize"] = formatSizeBuiltin
+}
+
+// parseDurationBuiltin parses a Go duration (e.g. 2h30m or 1.5s),
+// returning seconds.
+func parseDurationBuiltin(s string) (float64, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("parseDuration: invalid duration %q", s)
+	}
+	return d.Seconds(), nil
+}
+
+// formatDurationBuiltin is the reverse of parseDurationBuiltin, formatting
+// seconds as Go does (e.g. 2h30m0s), to the nearest nanosecond.
+func formatDurationBuiltin(seconds float64) (string, error) {
+	nanoseconds := math.Round(seconds * float64(time.Second))
+	if math.IsNaN(nanoseconds) || math.Abs(nanoseconds) >= math.MaxInt64 {
+		return "", fmt.Errorf("formatDuration: %v seconds is out of range (about 292 years either way)", seconds)
+	}
+	return time.Duration(nanoseconds).String(), nil
+}
+
+// sizeUnits are the suffixes parseSize understands: SI (powers of 1000,
+// where M isn't m, which would be milli) and IEC (powers of 1024), each
+// optionally followed by B.
+var sizeUnits = map[string]float64{
+	"":  1,
+	"k": 1e3, "K": 1e3, "M": 1e6, "G": 1e9, "T": 1e12, "P": 1e15, "E": 1e18,
+	"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30, "Ti": 1 << 40, "Pi": 1 << 50, "Ei": 1 << 60,
+}
+
+var sizeRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?|\.[0-9]+)\s*([A-Za-z]*)$`)
+
+// parseSizeBuiltin parses a size such as 512Mi, 1.5GB or 100, returning
+// bytes.
+func parseSizeBuiltin(s string) (float64, error) {
+	match := sizeRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return 0, fmt.Errorf("parseSize: invalid size %q", s)
+	}
+	unit := match[2]
+	multiplier, ok := sizeUnits[unit]
+	if !ok && strings.HasSuffix(unit, "B") {
+		multiplier, ok = sizeUnits[strings.TrimSuffix(unit, "B")]
+	}
+	if !ok {
+		return 0, fmt.Errorf("parseSize: invalid size %q: unknown unit %q (use k, M, G, T, P or E for powers of 1000, or Ki, Mi, Gi, Ti, Pi or Ei for powers of 1024)", s, unit)
+	}
+	n, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("parseSize: invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// sizeStyles are the unit suffixes formatSize uses, largest first, which
+// parseSize (and Kubernetes) understand.
+var sizeStyles = map[string][]string{
+	"si":  {"E", "P", "T", "G", "M", "k"},
+	"iec": {"Ei", "Pi", "Ti", "Gi", "Mi", "Ki"},
+}
+
+// formatSizeBuiltin formats bytes with the largest unit of style (si or
+// iec) that leaves at least 1, to at most two decimal places (e.g. 1.5Gi).
+func formatSizeBuiltin(bytes float64, style string) (string, error) {
+	units, ok := sizeStyles[style]
+	if !ok {
+		return "", fmt.Errorf("formatSize: style %q should be si or iec", style)
+	}
+	if bytes < 0 || math.IsNaN(bytes) || math.IsInf(bytes, 0) {
+		return "", fmt.Errorf("formatSize: %v isn't a size in bytes", bytes)
+	}
+	for _, unit := range units {
+		if multiplier := sizeUnits[unit]; bytes >= multiplier {
+			return formatSizeNumber(bytes/multiplier) + unit, nil
+		}
+	}
+	return formatSizeNumber(bytes), nil
+}
+
+func formatSizeNumber(n float64) string {
+	return strconv.FormatFloat(math.Round(n*100)/100, 'f', -1, 64)
+}
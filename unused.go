@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/wryun/rjsone/ext"
+)
+
+// collectIdentifiers adds every identifier used by an expression in the
+// template to used. It over-approximates (e.g. names bound by $let are
+// included), so a key missing from used is definitely never referenced.
+func collectIdentifiers(template interface{}, used map[string]bool) {
+	switch typedTemplate := template.(type) {
+	case string:
+		collectInterpolated(typedTemplate, used)
+	case []interface{}:
+		for _, child := range typedTemplate {
+			collectIdentifiers(child, used)
+		}
+	case map[string]interface{}:
+		for k, v := range typedTemplate {
+			collectInterpolated(k, used)
+			if s, ok := v.(string); ok && (k == "$eval" || k == "$if" || strings.HasPrefix(k, "by(")) {
+				collectExpression(s, used)
+				continue
+			}
+			collectIdentifiers(v, used)
+		}
+	}
+}
+
+// collectInterpolated handles the ${...} sections of a string.
+func collectInterpolated(s string, used map[string]bool) {
+	for {
+		start := strings.Index(s, "${")
+		if start == -1 {
+			return
+		}
+		if start > 0 && s[start-1] == '$' {
+			// $${ is an escaped ${
+			s = s[start+2:]
+			continue
+		}
+		end := strings.Index(s[start:], "}")
+		if end == -1 {
+			return
+		}
+		collectExpression(s[start+2:start+end], used)
+		s = s[start+end+1:]
+	}
+}
+
+// collectExpression adds the identifiers in a json-e expression, ignoring
+// string literals and property accesses (a.b only uses a).
+func collectExpression(expression string, used map[string]bool) {
+	runes := []rune(expression)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '"' || r == '\'':
+			for i++; i < len(runes) && runes[i] != r; i++ {
+			}
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			if !precededByDot(runes, start) {
+				used[string(runes[start:i])] = true
+			}
+			i--
+		case unicode.IsDigit(r):
+			for i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.') {
+				i++
+			}
+		}
+	}
+}
+
+func precededByDot(runes []rune, i int) bool {
+	for i--; i >= 0 && unicode.IsSpace(runes[i]); i-- {
+	}
+	return i >= 0 && runes[i] == '.'
+}
+
+// unusedKeys returns the sorted keys of context which aren't in used.
+func unusedKeys(context map[string]interface{}, used map[string]bool) []string {
+	unused := make([]string, 0)
+	for k := range context {
+		if _, ok := ext.Function(k); ok {
+			// like json-e's builtins, these don't have to be used
+			continue
+		}
+		if !used[k] {
+			unused = append(unused, k)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
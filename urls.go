@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+)
+
+func init() {
+	builtins["urlParse"] = urlParseBuiltin
+	builtins["urlJoin"] = urlJoinBuiltin
+	builtins["urlEncode"] = urlEncodeBuiltin
+	builtins["urlDecode"] = urlDecodeBuiltin
+}
+
+// urlParseBuiltin splits a URL into its parts. host has no port, or
+// brackets around an IPv6 address. path and query are left encoded, since
+// decoding them loses the difference between / and %2F or & and %26.
+func urlParseBuiltin(s string) (map[string]interface{}, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("urlParse: %s", err)
+	}
+	return map[string]interface{}{
+		"scheme":   u.Scheme,
+		"host":     u.Hostname(),
+		"port":     u.Port(),
+		"path":     u.EscapedPath(),
+		"query":    u.RawQuery,
+		"fragment": u.Fragment,
+	}, nil
+}
+
+// urlJoinBuiltin resolves ref relative to base, as a browser would a link
+// (RFC 3986), so a ref starting with / replaces the whole path.
+func urlJoinBuiltin(base string, ref string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("urlJoin: base: %s", err)
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("urlJoin: ref: %s", err)
+	}
+	return baseURL.ResolveReference(refURL).String(), nil
+}
+
+// urlEncodeBuiltin escapes s to be a URL component (e.g. a query
+// parameter), so it escapes / and % too.
+func urlEncodeBuiltin(s string) string {
+	return url.QueryEscape(s)
+}
+
+func urlDecodeBuiltin(s string) (string, error) {
+	decoded, err := url.QueryUnescape(s)
+	if err != nil {
+		return "", fmt.Errorf("urlDecode: %s", err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func init() {
+	storeSources["vault"] = storeSource{
+		description: "HashiCorp Vault KV secret (v1 or v2) at the path, using VAULT_ADDR and VAULT_TOKEN",
+		load:        readVaultSecret,
+	}
+}
+
+// vaultClient reads from the Vault HTTP API. The token is only ever sent
+// as a header, so it can't end up in errors (which include the URL).
+type vaultClient struct {
+	addr      string
+	token     string
+	namespace string
+}
+
+// errVaultNotFound is returned by get for a 404.
+var errVaultNotFound = errors.New("not found")
+
+// readVaultSecret reads the data of the KV secret at path. For KV v2 the
+// path can be given with or without the data/ after the mount, as for
+// vault kv get.
+func readVaultSecret(path string) (interface{}, error) {
+	client := &vaultClient{
+		addr:      strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/"),
+		token:     os.Getenv("VAULT_TOKEN"),
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+	if client.addr == "" {
+		return nil, errors.New("VAULT_ADDR isn't set")
+	}
+	if client.token == "" {
+		return nil, errors.New("VAULT_TOKEN isn't set")
+	}
+
+	path = strings.Trim(path, "/")
+	mount, version := client.mount(path)
+	if version == "2" {
+		relative := strings.TrimPrefix(path, mount)
+		if !strings.HasPrefix(relative, "data/") {
+			path = mount + "data/" + relative
+		}
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := client.get(path, &secret); err == errVaultNotFound {
+		return nil, errors.New("no secret at this path")
+	} else if err != nil {
+		return nil, err
+	}
+
+	// if we couldn't find out the version, a KV v2 response is recognisable
+	// by its metadata
+	_, hasMetadata := secret.Data["metadata"].(map[string]interface{})
+	if data, ok := secret.Data["data"].(map[string]interface{}); ok && (version == "2" || version == "" && hasMetadata) {
+		return data, nil
+	}
+	if version == "2" {
+		// a deleted (but not destroyed) version has null data
+		return nil, errors.New("the latest version of the secret has been deleted")
+	}
+	return secret.Data, nil
+}
+
+// mount returns the mount path (with a trailing /) and KV version of path,
+// or an empty version if the token can't look it up.
+func (c *vaultClient) mount(path string) (string, string) {
+	var mount struct {
+		Data struct {
+			Path    string            `json:"path"`
+			Options map[string]string `json:"options"`
+		} `json:"data"`
+	}
+	if err := c.get("sys/internal/ui/mounts/"+path, &mount); err != nil || mount.Data.Path == "" {
+		return "", ""
+	}
+	version := mount.Data.Options["version"]
+	if version == "" {
+		version = "1"
+	}
+	return mount.Data.Path, version
+}
+
+func (c *vaultClient) get(path string, result interface{}) error {
+	request, err := http.NewRequest("GET", c.addr+"/v1/"+path, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("X-Vault-Token", c.token)
+	if c.namespace != "" {
+		request.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return errVaultNotFound
+	case response.StatusCode == http.StatusForbidden:
+		return errors.New("permission denied (check VAULT_TOKEN is valid and its policies allow reading this path)")
+	case response.StatusCode < 200 || response.StatusCode > 299:
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(body, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("Vault returned %s: %s", response.Status, strings.Join(vaultErr.Errors, "; "))
+		}
+		return fmt.Errorf("Vault returned %s", response.Status)
+	}
+	return json.Unmarshal(body, result)
+}
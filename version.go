@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+)
+
+// These are set at build time with, for example:
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.commit=$(git rev-parse HEAD)"
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+const jsonePackage = "github.com/taskcluster/json-e"
+
+func printVersion(w io.Writer) error {
+	jsoneVersion := "unknown"
+	buildCommit, buildDate := commit, date
+
+	// Fill in what we can from the Go build information if the linker
+	// flags weren't given.
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == jsonePackage {
+				jsoneVersion = dep.Version
+			}
+		}
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && buildCommit == "":
+				buildCommit = setting.Value
+			case setting.Key == "vcs.time" && buildDate == "":
+				buildDate = setting.Value
+			}
+		}
+	}
+
+	if buildCommit == "" {
+		buildCommit = "unknown"
+	}
+	if buildDate == "" {
+		buildDate = "unknown"
+	}
+
+	_, err := fmt.Fprintf(w, "rjsone %s\njson-e %s\ncommit %s\nbuilt %s\n", version, jsoneVersion, buildCommit, buildDate)
+	return err
+}
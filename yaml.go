@@ -0,0 +1,417 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	// Quick hack of ghodss YAML to expose a new method
+	yaml_ghodss "github.com/wryun/yaml-1"
+	yaml_v2 "gopkg.in/yaml.v2"
+	yaml_v3 "gopkg.in/yaml.v3"
+)
+
+// yaml11 reads templates and YAML contexts with YAML 1.1's coercions
+// (e.g. NO is false and 0644 is 420), as rjsone used to (-yaml-1.1).
+// Otherwise they're read using the YAML 1.2 core schema.
+var yaml11 = false
+
+// yamlDecoder reads a stream of YAML documents as JSON types (i.e. what
+// json-e expects: map[string]interface{}, float64 and so on).
+type yamlDecoder struct {
+	v2 *yaml_v2.Decoder
+	v3 *yaml_v3.Decoder
+}
+
+func newYAMLDecoder(r io.Reader) *yamlDecoder {
+	if yaml11 {
+		return &yamlDecoder{v2: yaml_v2.NewDecoder(r)}
+	}
+	return &yamlDecoder{v3: yaml_v3.NewDecoder(r)}
+}
+
+// decode returns the next document, or io.EOF if there are no more.
+func (d *yamlDecoder) decode() (interface{}, error) {
+	if d.v2 != nil {
+		// json-e wants types as output by json, so we have to reach
+		// into the annoying ghodss/yaml code to do the type conversion.
+		// We can't use it directly (trivially), because it doesn't have
+		// multi-document support.
+		var passthrough interface{}
+		if err := d.v2.Decode(&passthrough); err != nil {
+			return nil, err
+		}
+		return yaml11ToJSONTypes(passthrough)
+	}
+
+	var node yaml_v3.Node
+	if err := d.v3.Decode(&node); err != nil {
+		return nil, err
+	}
+	if err := checkAliases(&node); err != nil {
+		return nil, err
+	}
+	return nodeToJSONTypes(&node, nil)
+}
+
+// yamlEncoder writes a stream of YAML documents.
+type yamlEncoder interface {
+	Encode(v interface{}) error
+	Close() error
+}
+
+// newYAMLEncoder returns yaml.v2's encoder, unless the indentation has
+// been changed from its fixed two spaces (with -indent yaml=N), which
+// only yaml.v3 supports.
+func newYAMLEncoder(w io.Writer, indent string) yamlEncoder {
+	if indent == "" || indent == "  " {
+		return yaml_v2.NewEncoder(w)
+	}
+	encoder := yaml_v3.NewEncoder(w)
+	encoder.SetIndent(len(indent))
+	return encoder
+}
+
+// unmarshalYAML reads a single YAML document as JSON types.
+func unmarshalYAML(data []byte) (interface{}, error) {
+	if yaml11 {
+		var passthrough interface{}
+		if err := yaml_v2.Unmarshal(data, &passthrough); err != nil {
+			return nil, err
+		}
+		return yaml11ToJSONTypes(passthrough)
+	}
+
+	var node yaml_v3.Node
+	if err := yaml_v3.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	if node.Kind == 0 {
+		// empty input
+		return nil, nil
+	}
+	if err := checkAliases(&node); err != nil {
+		return nil, err
+	}
+	return nodeToJSONTypes(&node, nil)
+}
+
+// yaml11ToJSONTypes converts a document decoded by yaml.v2. Keys are
+// converted to strings by ghodss (so 80 is "80" and yes is "true"), but
+// the keys it can't convert are checked first, so the error says where
+// they are.
+func yaml11ToJSONTypes(passthrough interface{}) (interface{}, error) {
+	if err := checkYAML11Keys(passthrough, nil); err != nil {
+		return nil, err
+	}
+	var result interface{}
+	if err := yaml_ghodss.YAMLTypesToJSONTypes(passthrough, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func checkYAML11Keys(v interface{}, path []string) error {
+	switch typedV := v.(type) {
+	case map[interface{}]interface{}:
+		for k, child := range typedV {
+			switch k.(type) {
+			case nil:
+				return fmt.Errorf("yaml: a null key (JSON keys must be strings) in the mapping at %s", formatPointer(path))
+			case map[interface{}]interface{}, []interface{}:
+				return fmt.Errorf("yaml: a key that isn't a scalar (JSON keys must be strings) in the mapping at %s", formatPointer(path))
+			}
+			if err := checkYAML11Keys(child, appendPath(path, fmt.Sprint(k))); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, child := range typedV {
+			if err := checkYAML11Keys(child, appendPath(path, strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// maxAliasNodes is how many nodes aliases can add to a document when
+// they're expanded, so a small document with nested aliases (a "billion
+// laughs") can't use up all the memory.
+const maxAliasNodes = 1000000
+
+// checkAliases returns an error if expanding node's aliases would add
+// more than maxAliasNodes nodes. yaml.v3 only limits this when decoding
+// into Go values, not into a Node.
+func checkAliases(node *yaml_v3.Node) error {
+	budget := maxAliasNodes
+	return walkAliases(node, &budget)
+}
+
+func walkAliases(node *yaml_v3.Node, budget *int) error {
+	if node.Kind == yaml_v3.AliasNode {
+		if err := countAlias(node.Alias, budget); err != nil {
+			return fmt.Errorf("yaml: line %d: %s", node.Line, err)
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := walkAliases(child, budget); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countAlias takes the nodes an alias to node expands to from budget.
+func countAlias(node *yaml_v3.Node, budget *int) error {
+	*budget--
+	if *budget < 0 {
+		return fmt.Errorf("aliases expand to more than %d nodes", maxAliasNodes)
+	}
+	if node.Kind == yaml_v3.AliasNode {
+		return countAlias(node.Alias, budget)
+	}
+	for _, child := range node.Content {
+		if err := countAlias(child, budget); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeToJSONTypes converts a parsed YAML document to JSON types. Plain
+// scalars are resolved using the YAML 1.2 core schema, rather than
+// yaml.v3's (which still reads 0644 as octal and resolves timestamps).
+// path is where node is in the document, for errors.
+func nodeToJSONTypes(node *yaml_v3.Node, path []string) (interface{}, error) {
+	if handler, ok := yamlTagHandlers[node.Tag]; ok && node.Style&yaml_v3.TaggedStyle != 0 {
+		return tagToJSONTypes(node, handler, path)
+	}
+	switch node.Kind {
+	case yaml_v3.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return nodeToJSONTypes(node.Content[0], path)
+	case yaml_v3.AliasNode:
+		return nodeToJSONTypes(node.Alias, path)
+	case yaml_v3.SequenceNode:
+		result := make([]interface{}, len(node.Content))
+		for i, child := range node.Content {
+			var err error
+			result[i], err = nodeToJSONTypes(child, appendPath(path, strconv.Itoa(i)))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case yaml_v3.MappingNode:
+		return mappingToJSONTypes(node, path)
+	case yaml_v3.ScalarNode:
+		return scalarToJSONTypes(node)
+	}
+	return nil, fmt.Errorf("yaml: line %d: unsupported YAML node", node.Line)
+}
+
+// tagToJSONTypes converts a node with a -yaml-tags tag by reading it as
+// if it wasn't tagged and passing that to the tag's handler.
+func tagToJSONTypes(node *yaml_v3.Node, handler yamlTagHandler, path []string) (interface{}, error) {
+	untagged := *node
+	untagged.Tag = ""
+	untagged.Style &^= yaml_v3.TaggedStyle
+	value, err := nodeToJSONTypes(&untagged, path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := handler(value)
+	if err != nil {
+		return nil, fmt.Errorf("yaml: line %d: %s at %s: %s", node.Line, node.Tag, formatPointer(path), err)
+	}
+	return result, nil
+}
+
+// mappingToJSONTypes converts a mapping to an object. Since JSON only has
+// string keys, scalar keys are used as they're written (so 80: http has
+// the key "80" and true: x has "true"); null and non-scalar keys are an
+// error.
+func mappingToJSONTypes(node *yaml_v3.Node, path []string) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(node.Content)/2)
+	// keys from << merges, which explicit keys override
+	merged := make(map[string]bool)
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+
+		if keyNode.Kind == yaml_v3.ScalarNode && keyNode.Tag == "!!merge" {
+			if err := mergeInto(result, merged, valueNode, path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		key, err := mappingKey(keyNode)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: %s in the mapping at %s", keyNode.Line, err, formatPointer(path))
+		}
+		if _, ok := result[key]; ok && !merged[key] {
+			return nil, fmt.Errorf("yaml: line %d: mapping key %q already defined", keyNode.Line, key)
+		}
+		delete(merged, key)
+
+		result[key], err = nodeToJSONTypes(valueNode, appendPath(path, key))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// mergeInto handles a << merge key, whose value is a mapping (usually
+// an alias) or a list of them.
+func mergeInto(result map[string]interface{}, merged map[string]bool, node *yaml_v3.Node, path []string) error {
+	if node.Kind == yaml_v3.AliasNode {
+		node = node.Alias
+	}
+	sources := []*yaml_v3.Node{node}
+	if node.Kind == yaml_v3.SequenceNode {
+		sources = node.Content
+	}
+
+	for _, source := range sources {
+		value, err := nodeToJSONTypes(source, path)
+		if err != nil {
+			return err
+		}
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("yaml: line %d: << should merge a mapping or list of mappings", source.Line)
+		}
+		for k, v := range m {
+			if _, ok := result[k]; !ok {
+				result[k] = v
+				merged[k] = true
+			}
+		}
+	}
+	return nil
+}
+
+// mappingKey converts a key to a string, as JSON objects require.
+func mappingKey(node *yaml_v3.Node) (string, error) {
+	if node.Kind == yaml_v3.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml_v3.ScalarNode {
+		return "", errors.New("a key that isn't a scalar (JSON keys must be strings)")
+	}
+	value, err := scalarToJSONTypes(node)
+	if err != nil {
+		return "", err
+	}
+	switch typedValue := value.(type) {
+	case string:
+		return typedValue, nil
+	case nil:
+		return "", errors.New("a null key (JSON keys must be strings)")
+	default:
+		// i.e. as written, so 1: x has the key "1"
+		return node.Value, nil
+	}
+}
+
+var (
+	coreNullRegexp  = regexp.MustCompile(`^(null|Null|NULL|~|)$`)
+	coreBoolRegexp  = regexp.MustCompile(`^(true|True|TRUE|false|False|FALSE)$`)
+	coreIntRegexp   = regexp.MustCompile(`^([-+]?[0-9]+|0o[0-7]+|0x[0-9a-fA-F]+)$`)
+	coreFloatRegexp = regexp.MustCompile(`^([-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?|[-+]?\.(inf|Inf|INF)|\.(nan|NaN|NAN))$`)
+)
+
+func scalarToJSONTypes(node *yaml_v3.Node) (interface{}, error) {
+	tag := node.Tag
+	if node.Style&yaml_v3.TaggedStyle == 0 {
+		if node.Style != 0 {
+			// quoted, literal or folded
+			return node.Value, nil
+		}
+		tag = resolveCoreTag(node.Value)
+	}
+
+	switch tag {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		return strings.ToLower(node.Value) == "true", nil
+	case "!!int":
+		return parseCoreInt(node)
+	case "!!float":
+		if strings.Contains(strings.ToLower(node.Value), ".inf") || strings.Contains(strings.ToLower(node.Value), ".nan") {
+			return nil, fmt.Errorf("yaml: line %d: %s can't be represented in JSON", node.Line, node.Value)
+		}
+		f, err := strconv.ParseFloat(node.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: invalid float %q", node.Line, node.Value)
+		}
+		return f, nil
+	case "!!str":
+		return node.Value, nil
+	case "!!timestamp", "!!binary":
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		if t, ok := value.(time.Time); ok {
+			return t.Format(time.RFC3339Nano), nil
+		}
+		return value, nil
+	}
+
+	// unknown (e.g. application specific) tags are ignored, as yaml.v2
+	// does, and the value resolved as if it wasn't tagged
+	if node.Style&^yaml_v3.TaggedStyle != 0 {
+		return node.Value, nil
+	}
+	node = &yaml_v3.Node{Kind: node.Kind, Value: node.Value, Line: node.Line}
+	return scalarToJSONTypes(node)
+}
+
+// resolveCoreTag returns the tag of a plain scalar in the core schema.
+func resolveCoreTag(value string) string {
+	switch {
+	case coreNullRegexp.MatchString(value):
+		return "!!null"
+	case coreBoolRegexp.MatchString(value):
+		return "!!bool"
+	case coreIntRegexp.MatchString(value):
+		return "!!int"
+	case coreFloatRegexp.MatchString(value):
+		return "!!float"
+	}
+	return "!!str"
+}
+
+func parseCoreInt(node *yaml_v3.Node) (interface{}, error) {
+	value := node.Value
+	base := 10
+	switch {
+	case strings.HasPrefix(value, "0o"):
+		value, base = value[2:], 8
+	case strings.HasPrefix(value, "0x"):
+		value, base = value[2:], 16
+	}
+	i, err := strconv.ParseInt(value, base, 64)
+	if err == nil {
+		return float64(i), nil
+	}
+	// too big for an int64, but JSON numbers are floats anyway
+	f, floatErr := strconv.ParseFloat(node.Value, 64)
+	if base != 10 || floatErr != nil {
+		return nil, fmt.Errorf("yaml: line %d: invalid integer %q", node.Line, node.Value)
+	}
+	return f, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// yamlTagHandler converts the value of a node with a custom tag (e.g.
+// !include), which it's given as it would be read without the tag.
+type yamlTagHandler func(value interface{}) (interface{}, error)
+
+// yamlTagHandlers are the custom tags handled when YAML is read, from the
+// -yaml-tags sets. Other custom tags are ignored.
+var yamlTagHandlers = make(map[string]yamlTagHandler)
+
+// yamlTagSet is a group of related tags that can be enabled by -yaml-tags.
+type yamlTagSet struct {
+	description string
+	handlers    func(opts *loadOptions) map[string]yamlTagHandler
+}
+
+var yamlTagSets = map[string]yamlTagSet{
+	"include":        {"!include file is replaced by the file's contents, read like readFile(file, \"\")", includeTagHandlers},
+	"cloudformation": {"CloudFormation's short form functions become their JSON form (!Ref x is {\"Ref\": x})", cloudFormationTagHandlers},
+}
+
+// registerYAMLTags enables the handlers of each of the comma separated
+// -yaml-tags sets.
+func registerYAMLTags(list string, opts *loadOptions) error {
+	for _, name := range strings.Split(list, ",") {
+		set, ok := yamlTagSets[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("-yaml-tags: unknown set %q (use %s)", strings.TrimSpace(name), strings.Join(sortedYAMLTagSets(), ", "))
+		}
+		for tag, handler := range set.handlers(opts) {
+			yamlTagHandlers[tag] = handler
+		}
+	}
+	return nil
+}
+
+func sortedYAMLTagSets() []string {
+	names := make([]string, 0, len(yamlTagSets))
+	for name := range yamlTagSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// includeTagHandlers handles !include, whose file is resolved like a
+// context's (so is relative to the template's directory with
+// -relative-to-template, not to the file it's in) and confined to -root.
+func includeTagHandlers(opts *loadOptions) map[string]yamlTagHandler {
+	// the files being included, so one that includes itself fails
+	// rather than recursing forever
+	including := make(map[string]bool)
+	return map[string]yamlTagHandler{
+		"!include": func(value interface{}) (interface{}, error) {
+			filename, ok := value.(string)
+			if !ok || filename == "" {
+				return nil, fmt.Errorf("should be a filename, not %s", describeType(value))
+			}
+			resolved := opts.resolve(filename)
+			if including[resolved] {
+				return nil, fmt.Errorf("%s includes itself", resolved)
+			}
+			including[resolved] = true
+			defer delete(including, resolved)
+
+			data, err := opts.readFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			result, err := loadBytes(inferFileFormat(filename, opts), data, opts)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", resolved, err)
+			}
+			return result, nil
+		},
+	}
+}
+
+// cloudFormationFunctions are the intrinsic functions with short form
+// tags, which are !Name for Fn::Name (except for Ref and Condition).
+var cloudFormationFunctions = []string{
+	"And", "Base64", "Cidr", "Condition", "Equals", "FindInMap", "GetAZs",
+	"GetAtt", "If", "ImportValue", "Join", "Not", "Or", "Ref", "Select",
+	"Split", "Sub", "Transform",
+}
+
+func cloudFormationTagHandlers(opts *loadOptions) map[string]yamlTagHandler {
+	handlers := make(map[string]yamlTagHandler, len(cloudFormationFunctions))
+	for _, name := range cloudFormationFunctions {
+		key := "Fn::" + name
+		if name == "Ref" || name == "Condition" {
+			key = name
+		}
+		handlers["!"+name] = func(value interface{}) (interface{}, error) {
+			return map[string]interface{}{key: value}, nil
+		}
+	}
+	handlers["!GetAtt"] = func(value interface{}) (interface{}, error) {
+		// the short form is resource.attribute, which the JSON form splits
+		if s, ok := value.(string); ok {
+			parts := strings.SplitN(s, ".", 2)
+			if len(parts) != 2 {
+				return nil, errors.New("should be resource.attribute")
+			}
+			value = []interface{}{parts[0], parts[1]}
+		}
+		return map[string]interface{}{"Fn::GetAtt": value}, nil
+	}
+	return handlers
+}